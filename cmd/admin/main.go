@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/config"
+	"github.com/dechat/exchange-service/internal/keystore"
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/storage"
+)
+
+const usage = `Usage: admin <command> <subcommand> [flags]
+
+Commands:
+  wallet generate -chain <chain>            generate new hot wallet
+  wallet import   -chain <chain>            import private key (read from stdin)
+  wallet list     [-chain <chain>]          list hot wallets with balances
+  wallet address  -chain <chain>            print active hot wallet addresses
+  wallet retire   -id <id>                  retire hot wallet
+  wallet rotate   -id <id> [-import]        replace active hot wallet
+  rescan start    -chain <chain> -from <n> -to <n>
+                                            queue block range rescan (run by server)
+  rescan list                               list latest rescan jobs
+  rescan status   -id <id>                  show rescan job progress
+`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "wallet":
+		err = runWallet(cfg, os.Args[2], os.Args[3:])
+	case "rescan":
+		err = runRescan(cfg, os.Args[2], os.Args[3:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+func openStorage(cfg *config.Config) (*storage.PostgresStorage, error) {
+	db, err := storage.New(cfg.Database.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+func openKeystore(cfg *config.Config) (*keystore.Keystore, error) {
+	if cfg.Keys.EncryptionKey == "" {
+		return nil, fmt.Errorf("KEY_ENCRYPTION_KEY is not set")
+	}
+	return keystore.NewFromHex(cfg.Keys.EncryptionKey)
+}
+
+// initAdapters connects to configured chains, unavailable chains are skipped
+func initAdapters(cfg *config.Config) map[models.Chain]adapters.BlockchainAdapter {
+	chainAdapters := make(map[models.Chain]adapters.BlockchainAdapter)
+	for chainName, chainCfg := range cfg.Chains {
+		adapter, err := adapters.NewEVMAdapter(chainCfg.RPCURL, chainCfg.ChainID)
+		if err != nil {
+			log.Printf("Warning: failed to initialize adapter for %s: %v", chainName, err)
+			continue
+		}
+		chainAdapters[models.Chain(chainName)] = adapter
+	}
+	return chainAdapters
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dechat/exchange-service/internal/config"
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/services"
+)
+
+// runRescan queues and inspects rescan jobs, they are processed by server rescan worker
+func runRescan(cfg *config.Config, subcommand string, args []string) error {
+	fs := flag.NewFlagSet("rescan "+subcommand, flag.ExitOnError)
+	chain := fs.String("chain", "", "chain name")
+	from := fs.Int64("from", -1, "first block")
+	to := fs.Int64("to", -1, "last block (inclusive)")
+	id := fs.Int64("id", 0, "rescan job id")
+	fs.Parse(args)
+
+	db, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	switch subcommand {
+	case "start":
+		if *chain == "" || *from < 0 || *to < 0 {
+			return fmt.Errorf("-chain, -from and -to are required")
+		}
+		monitor := services.NewDepositMonitor(db, initAdapters(cfg), nil, cfg.Deposit.ToleranceBPS, nil)
+		job, err := services.NewRescanService(db, monitor).CreateJob(ctx, models.Chain(*chain), *from, *to)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rescan %d queued for %s: blocks %d-%d\n", job.ID, job.Chain, job.FromBlock, job.ToBlock)
+		return nil
+
+	case "list":
+		jobs, err := services.NewRescanService(db, nil).ListJobs(ctx)
+		if err != nil {
+			return err
+		}
+		printRescanJobs(jobs)
+		return nil
+
+	case "status":
+		if *id == 0 {
+			return fmt.Errorf("-id is required")
+		}
+		job, err := services.NewRescanService(db, nil).GetJob(ctx, *id)
+		if err != nil {
+			return err
+		}
+		printRescanJobs([]*models.RescanJob{job})
+		if len(job.FailedBlocks) > 0 {
+			fmt.Printf("Failed blocks: %v\n", job.FailedBlocks)
+		}
+		if job.Error != "" {
+			fmt.Printf("Error: %s\n", job.Error)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown rescan subcommand: %s", subcommand)
+}
+
+func printRescanJobs(jobs []*models.RescanJob) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCHAIN\tFROM\tTO\tNEXT\tSTATUS")
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%s\n", job.ID, job.Chain, job.FromBlock, job.ToBlock, job.NextBlock, job.Status)
+	}
+	w.Flush()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dechat/exchange-service/internal/config"
+	"github.com/dechat/exchange-service/internal/keystore"
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/services"
+	"golang.org/x/term"
+)
+
+func runWallet(cfg *config.Config, subcommand string, args []string) error {
+	fs := flag.NewFlagSet("wallet "+subcommand, flag.ExitOnError)
+	chain := fs.String("chain", "", "chain name")
+	id := fs.Int64("id", 0, "hot wallet id")
+	importKey := fs.Bool("import", false, "rotate: import key from stdin instead of generating")
+	fs.Parse(args)
+
+	db, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	switch subcommand {
+	case "list":
+		svc := services.NewHotWalletService(db, initAdapters(cfg), nil)
+		wallets, err := svc.ListHotWallets(ctx, models.Chain(*chain))
+		if err != nil {
+			return err
+		}
+		printWallets(wallets)
+		return nil
+
+	case "address":
+		if *chain == "" {
+			return fmt.Errorf("-chain is required")
+		}
+		wallets, err := db.GetActiveHotWallets(models.Chain(*chain))
+		if err != nil {
+			return err
+		}
+		if len(wallets) == 0 {
+			return fmt.Errorf("hot wallet not found for chain %s", *chain)
+		}
+		for _, wallet := range wallets {
+			fmt.Println(wallet.Address)
+		}
+		return nil
+
+	case "retire":
+		if *id == 0 {
+			return fmt.Errorf("-id is required")
+		}
+		svc := services.NewHotWalletService(db, nil, nil)
+		if err := svc.RetireHotWallet(ctx, *id); err != nil {
+			return err
+		}
+		fmt.Printf("Hot wallet %d retired\n", *id)
+		return nil
+
+	case "rotate":
+		if *id == 0 {
+			return fmt.Errorf("-id is required")
+		}
+		keys, err := openKeystore(cfg)
+		if err != nil {
+			return err
+		}
+		var privateKey []byte
+		if *importKey {
+			privateKey, err = readPrivateKey()
+			if err != nil {
+				return err
+			}
+			defer keystore.Wipe(privateKey)
+		}
+		svc := services.NewHotWalletService(db, nil, keys)
+		wallet, err := svc.RotateHotWallet(ctx, *id, privateKey)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Hot wallet %d retired, %d active for %s: %s\n", *id, wallet.ID, wallet.Chain, wallet.Address)
+		return nil
+	}
+
+	// Commands below encrypt keys
+	if *chain == "" {
+		return fmt.Errorf("-chain is required")
+	}
+	keys, err := openKeystore(cfg)
+	if err != nil {
+		return err
+	}
+	svc := services.NewHotWalletService(db, nil, keys)
+
+	var wallet *models.HotWallet
+	switch subcommand {
+	case "generate":
+		wallet, err = svc.GenerateHotWallet(ctx, models.Chain(*chain))
+	case "import":
+		var privateKey []byte
+		privateKey, err = readPrivateKey()
+		if err != nil {
+			return err
+		}
+		defer keystore.Wipe(privateKey)
+		wallet, err = svc.ImportHotWallet(ctx, models.Chain(*chain), privateKey)
+	default:
+		return fmt.Errorf("unknown wallet subcommand: %s", subcommand)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Hot wallet %d active for %s: %s\n", wallet.ID, wallet.Chain, wallet.Address)
+	return nil
+}
+
+// readPrivateKey reads key from stdin so it doesn't end up in shell history.
+// Terminal input isn't echoed, piped input is read up to newline. Caller must wipe returned buffer.
+func readPrivateKey() ([]byte, error) {
+	fmt.Fprint(os.Stderr, "Private key (hex): ")
+	line, err := readSecretLine(os.Stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	key := bytes.TrimSpace(line)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("private key is empty")
+	}
+	return key, nil
+}
+
+// readSecretLine reads line without echo from terminal, or from pipe as is
+func readSecretLine(f *os.File) ([]byte, error) {
+	if fd := int(f.Fd()); term.IsTerminal(fd) {
+		return term.ReadPassword(fd)
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, err
+	}
+	return line, nil
+}
+
+func printWallets(wallets []*models.HotWallet) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCHAIN\tADDRESS\tSTATUS\tBALANCE")
+	for _, wallet := range wallets {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", wallet.ID, wallet.Chain, wallet.Address, wallet.Status, wallet.Balance)
+	}
+	w.Flush()
+}
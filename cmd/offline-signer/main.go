@@ -0,0 +1,88 @@
+// Command offline-signer signs transaction bundles exported by the service.
+// Meant to run on air-gapped machine, it never touches network.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dechat/exchange-service/internal/keystore"
+	"github.com/dechat/exchange-service/internal/offline"
+	"golang.org/x/term"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	in := flag.String("in", "", "unsigned bundle file (JSON)")
+	out := flag.String("out", "", "signed bundle file, stdout if empty")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("Failed to read bundle: %v", err)
+	}
+
+	var bundle offline.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		log.Fatalf("Failed to decode bundle: %v", err)
+	}
+
+	// Summary is recomputed from transaction, summary in file could be anything
+	fmt.Fprintf(os.Stderr, "Transfer #%d\n%s\n\n", bundle.TransferID, offline.Summarize(bundle.Chain, &bundle.Transaction))
+	fmt.Fprint(os.Stderr, "Private key (hex), empty to abort: ")
+
+	line, err := readSecretLine(os.Stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		log.Fatalf("Failed to read private key: %v", err)
+	}
+
+	privateKey := bytes.TrimSpace(line)
+	if len(privateKey) == 0 {
+		log.Fatal("Aborted")
+	}
+
+	signed, err := offline.Sign(&bundle, privateKey)
+	keystore.Wipe(line)
+	if err != nil {
+		log.Fatalf("Failed to sign: %v", err)
+	}
+
+	result, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode signed bundle: %v", err)
+	}
+
+	if *out == "" {
+		fmt.Println(string(result))
+		return
+	}
+	if err := os.WriteFile(*out, append(result, '\n'), 0o644); err != nil {
+		log.Fatalf("Failed to write signed bundle: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Signed tx %s written to %s\n", signed.Hash, *out)
+}
+
+// readSecretLine reads line without echo from terminal, so key isn't left on screen,
+// or from pipe as is
+func readSecretLine(f *os.File) ([]byte, error) {
+	if fd := int(f.Fd()); term.IsTerminal(fd) {
+		return term.ReadPassword(fd)
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, err
+	}
+	return line, nil
+}
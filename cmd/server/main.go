@@ -13,10 +13,12 @@ import (
 	"github.com/dechat/exchange-service/internal/adapters"
 	"github.com/dechat/exchange-service/internal/api"
 	"github.com/dechat/exchange-service/internal/config"
+	"github.com/dechat/exchange-service/internal/keystore"
 	"github.com/dechat/exchange-service/internal/models"
 	"github.com/dechat/exchange-service/internal/services"
 	"github.com/dechat/exchange-service/internal/storage"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -27,16 +29,7 @@ func main() {
 	}
 
 	// Connect to database
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.DBName,
-		cfg.Database.SSLMode,
-	)
-
-	db, err := storage.New(dsn)
+	db, err := storage.New(cfg.Database.DSN())
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -55,10 +48,109 @@ func main() {
 		log.Printf("Initialized adapter for chain: %s", chainName)
 	}
 
+	// Hot wallet keys are encrypted with KEY_ENCRYPTION_KEY (see cmd/admin)
+	var keys *keystore.Keystore
+	if cfg.Keys.EncryptionKey != "" {
+		keys, err = keystore.NewFromHex(cfg.Keys.EncryptionKey)
+		if err != nil {
+			log.Fatalf("Failed to load encryption key: %v", err)
+		}
+	} else {
+		log.Printf("Warning: KEY_ENCRYPTION_KEY not set, using ephemeral key - hot wallets won't be usable")
+		keys = keystore.NewEphemeral()
+	}
+
+	walletSelector, err := services.NewWalletSelector(services.WalletStrategy(cfg.Withdrawal.WalletStrategy))
+	if err != nil {
+		log.Fatalf("Invalid withdrawal config: %v", err)
+	}
+
+	approvalThresholds := make(map[models.Chain]string)
+	for chainName, chainCfg := range cfg.Chains {
+		approvalThresholds[models.Chain(chainName)] = chainCfg.ApprovalThreshold
+	}
+	serviceFees := make(map[models.Chain]services.ServiceFee)
+	lowPriorityMaxGasPrices := make(map[models.Chain]string)
+	for chainName, chainCfg := range cfg.Chains {
+		fee, err := services.NewServiceFee(chainCfg.ServiceFee, chainCfg.ServiceFeeBPS)
+		if err != nil {
+			log.Fatalf("Invalid withdrawal service fee for %s: %v", chainName, err)
+		}
+		serviceFees[models.Chain(chainName)] = fee
+		lowPriorityMaxGasPrices[models.Chain(chainName)] = chainCfg.LowPriorityMaxGasPrice
+	}
+	priorityPolicy, err := services.NewPriorityPolicy(cfg.Withdrawal.UrgentGasPricePercent, lowPriorityMaxGasPrices, cfg.Withdrawal.LowPriorityMaxDelay)
+	if err != nil {
+		log.Fatalf("Invalid withdrawal priority config: %v", err)
+	}
+	approvalPolicy, err := services.NewApprovalPolicy(approvalThresholds, cfg.Withdrawal.ApprovalDestinations, cfg.Withdrawal.ApprovalUsers, cfg.Withdrawal.RequiredApprovals)
+	if err != nil {
+		log.Fatalf("Invalid withdrawal approval config: %v", err)
+	}
+	whitelistMerchants := make(map[string]bool)
+	for _, merchantID := range cfg.Withdrawal.WhitelistMerchants {
+		whitelistMerchants[merchantID] = true
+	}
+	switch cfg.Withdrawal.ContractDestinations {
+	case "allow", "reject":
+	default:
+		log.Fatalf("Invalid withdrawal contract destinations policy: %q", cfg.Withdrawal.ContractDestinations)
+	}
+
 	// Initialize services
-	walletService := services.NewWalletService(db, chainAdapters)
-	withdrawalService := services.NewWithdrawalService(db, chainAdapters)
-	depositMonitor := services.NewDepositMonitor(db, chainAdapters)
+	addressIndex := services.NewAddressIndex(db, cfg.Deposit.AddressBloom)
+	monitorConfigs := make(map[models.Chain]services.ChainMonitorConfig)
+	for chainName, chainCfg := range cfg.Chains {
+		policy := services.ConfirmationPolicy(chainCfg.ConfirmationPolicy)
+		switch policy {
+		case services.ConfirmationBlocks, services.ConfirmationSafe, services.ConfirmationFinalized:
+		default:
+			log.Fatalf("Invalid confirmation policy for %s: %q", chainName, policy)
+		}
+		monitorConfigs[models.Chain(chainName)] = services.ChainMonitorConfig{
+			Confirmation:     policy,
+			MinConfirmations: chainCfg.MinConfirmations,
+		}
+	}
+
+	withdrawalService := services.NewWithdrawalService(db, chainAdapters, keys, walletSelector, services.WithdrawalPolicy{
+		Approvals:          approvalPolicy,
+		AddressCooldown:    cfg.Withdrawal.AddressCooldown,
+		WhitelistMerchants: whitelistMerchants,
+		RejectContracts:    cfg.Withdrawal.ContractDestinations == "reject",
+		ServiceFees:        serviceFees,
+		Priorities:         priorityPolicy,
+		Confirmations:      monitorConfigs,
+	})
+	walletService := services.NewWalletService(db, chainAdapters, withdrawalService, services.DepositExpiry{
+		TTL:             cfg.Deposit.TTL,
+		LateGracePeriod: cfg.Deposit.LateGracePeriod,
+	}, addressIndex)
+	depositMonitor := services.NewDepositMonitor(db, chainAdapters, monitorConfigs, cfg.Deposit.ToleranceBPS, addressIndex)
+
+	rebalancePolicies := make(map[models.Chain]*services.RebalancePolicy)
+	for chainName, chainCfg := range cfg.Chains {
+		rb := chainCfg.Rebalance
+		policy, err := services.NewRebalancePolicy(rb.MinBalance, rb.TargetBalance, rb.MaxBalance, rb.ColdAddress)
+		if err != nil {
+			log.Fatalf("Invalid rebalance config for %s: %v", chainName, err)
+		}
+		if policy != nil {
+			rebalancePolicies[models.Chain(chainName)] = policy
+		}
+	}
+	mempoolModes := make(map[models.Chain]adapters.MempoolMode)
+	for chainName, chainCfg := range cfg.Chains {
+		switch mode := adapters.MempoolMode(chainCfg.MempoolMode); mode {
+		case adapters.MempoolDisabled, adapters.MempoolSubscribe, adapters.MempoolTxpool:
+			mempoolModes[models.Chain(chainName)] = mode
+		default:
+			log.Fatalf("Invalid mempool mode for %s: %q", chainName, mode)
+		}
+	}
+	mempoolWatcher := services.NewMempoolWatcher(db, chainAdapters, addressIndex, mempoolModes)
+
+	rebalanceService := services.NewRebalanceService(db, chainAdapters, keys, rebalancePolicies)
 
 	// Start deposit monitor
 	ctx, cancel := context.WithCancel(context.Background())
@@ -67,6 +159,42 @@ func main() {
 	if err := depositMonitor.Start(ctx); err != nil {
 		log.Fatalf("Failed to start deposit monitor: %v", err)
 	}
+	mempoolWatcher.Start(ctx)
+
+	// Keep address index in sync with other instances, periodic reload drops expired addresses
+	go func() {
+		if err := storage.ListenDepositAddresses(ctx, cfg.Database.DSN(), addressIndex.Add, addressIndex.LoadAll); err != nil {
+			log.Printf("Deposit address listener stopped: %v", err)
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				addressIndex.LoadAll()
+			}
+		}
+	}()
+
+	// Keep deposit address pool filled
+	addressPool := services.NewAddressPool(db, chainAdapters, cfg.Deposit.AddressPoolSize)
+	go func() {
+		addressPool.Refill(ctx)
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				addressPool.Refill(ctx)
+			}
+		}
+	}()
 
 	// Start withdrawal processor (runs periodically)
 	go func() {
@@ -81,19 +209,105 @@ func main() {
 					if err := withdrawalService.ProcessPendingWithdrawals(ctx, chain); err != nil {
 						log.Printf("Error processing withdrawals for %s: %v", chain, err)
 					}
+					if err := withdrawalService.CheckSentWithdrawals(ctx, chain); err != nil {
+						log.Printf("Error checking sent withdrawals for %s: %v", chain, err)
+					}
+				}
+			}
+		}
+	}()
+
+	// Start hot/cold rebalancing
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				rebalanceService.Rebalance(ctx)
+			}
+		}
+	}()
+
+	// Expire unpaid deposits
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := walletService.ExpireDeposits(ctx); err != nil {
+					log.Printf("Error expiring deposits: %v", err)
+				}
+			}
+		}
+	}()
+
+	// Start rescan worker, it runs admin requested block range rescans
+	rescanService := services.NewRescanService(db, depositMonitor)
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := rescanService.ProcessJobs(ctx); err != nil {
+					log.Printf("Error processing rescan jobs: %v", err)
 				}
 			}
 		}
 	}()
 
 	// Setup API routes
-	handlers := api.NewHandlers(walletService, withdrawalService)
+	offlineSigningService := services.NewOfflineSigningService(db, chainAdapters)
+	handlers := api.NewHandlers(walletService, withdrawalService, offlineSigningService, rescanService)
 	router := mux.NewRouter()
 
 	router.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
 	router.HandleFunc("/api/v1/deposit/address", handlers.GenerateDepositAddress).Methods("POST")
+	router.HandleFunc("/api/v1/deposit/{id}", handlers.GetDeposit).Methods("GET")
+	router.HandleFunc("/api/v1/deposit/{id}/qr", handlers.GetDepositQR).Methods("GET")
+	router.HandleFunc("/api/v1/deposit/{id}/resolve", handlers.ResolveDeposit).Methods("POST")
+	router.HandleFunc("/api/v1/users/{user_id}/credits", handlers.GetUserCredits).Methods("GET")
+	router.HandleFunc("/api/v1/users/{user_id}/withdrawal-addresses", handlers.ListWithdrawalAddresses).Methods("GET")
+	router.HandleFunc("/api/v1/users/{user_id}/withdrawal-addresses", handlers.AddWithdrawalAddress).Methods("POST")
+	router.HandleFunc("/api/v1/users/{user_id}/withdrawal-addresses/{id}", handlers.DeleteWithdrawalAddress).Methods("DELETE")
+	router.HandleFunc("/api/v1/users/{user_id}/withdrawal-settings", handlers.GetWithdrawalSettings).Methods("GET")
+	router.HandleFunc("/api/v1/users/{user_id}/withdrawal-settings", handlers.SetWithdrawalSettings).Methods("PUT")
 	router.HandleFunc("/api/v1/balance/{chain}", handlers.GetBalance).Methods("GET")
 	router.HandleFunc("/api/v1/withdrawal", handlers.CreateWithdrawal).Methods("POST")
+	router.HandleFunc("/api/v1/withdrawal/quote", handlers.QuoteWithdrawal).Methods("GET")
+	router.HandleFunc("/api/v1/withdrawal/{id}", handlers.GetWithdrawal).Methods("GET")
+
+	// Admin, authenticated by ADMIN_TOKENS
+	if len(cfg.Admin.Tokens) == 0 {
+		log.Printf("ADMIN_TOKENS is not set, admin API rejects all requests")
+	}
+	admin := router.PathPrefix("/api/v1/admin").Subrouter()
+	admin.Use(api.AdminAuth(cfg.Admin.Tokens))
+	admin.HandleFunc("/wallet-transfers", handlers.ListWalletTransfers).Methods("GET")
+	admin.HandleFunc("/wallet-transfers/{id}/bundle", handlers.ExportTransferBundle).Methods("GET")
+	admin.HandleFunc("/wallet-transfers/{id}/signed", handlers.ImportSignedTransfer).Methods("POST")
+	admin.HandleFunc("/wrong-asset-transfers", handlers.ListWrongAssetTransfers).Methods("GET")
+	admin.HandleFunc("/rescans", handlers.CreateRescan).Methods("POST")
+	admin.HandleFunc("/rescans", handlers.ListRescans).Methods("GET")
+	admin.HandleFunc("/rescans/{id}", handlers.GetRescan).Methods("GET")
+	admin.HandleFunc("/withdrawals", handlers.ListWithdrawals).Methods("GET")
+	admin.HandleFunc("/withdrawals/{id}/approve", handlers.ApproveWithdrawal).Methods("POST")
+	admin.HandleFunc("/withdrawals/{id}/reject", handlers.RejectWithdrawal).Methods("POST")
+	admin.HandleFunc("/withdrawals/{id}/cancel", handlers.CancelWithdrawal).Methods("POST")
+	admin.HandleFunc("/withdrawal-limits", handlers.ListWithdrawalLimits).Methods("GET")
+	admin.HandleFunc("/withdrawal-limits", handlers.SetWithdrawalLimit).Methods("POST")
+	admin.HandleFunc("/withdrawal-limits/{id}", handlers.DeleteWithdrawalLimit).Methods("DELETE")
+	admin.HandleFunc("/merchants/{merchant_id}/fee-settings", handlers.GetMerchantFeeSettings).Methods("GET")
+	admin.HandleFunc("/merchants/{merchant_id}/fee-settings", handlers.SetMerchantFeeSettings).Methods("PUT")
 
 	// Start HTTP server
 	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
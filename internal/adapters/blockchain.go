@@ -2,7 +2,24 @@ package adapters
 
 import (
 	"context"
+	"errors"
 	"math/big"
+	"time"
+)
+
+var (
+	// ErrTransactionNotFound - tx is neither in mempool nor in chain of the node
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrNonceTooLow - tx nonce was already used by another mined transaction
+	ErrNonceTooLow = errors.New("nonce too low")
+	// ErrInvalidAddress - address is not valid for the chain
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrExecutionReverted - destination contract reverts the transfer
+	ErrExecutionReverted = errors.New("execution reverted")
+	// ErrInsufficientFunds - node rejected tx, sender can't pay value plus gas
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrInvalidSender - node rejected tx signature (e.g. wrong chain id)
+	ErrInvalidSender = errors.New("invalid sender")
 )
 
 // BlockchainAdapter interface for different blockchains
@@ -10,37 +27,131 @@ type BlockchainAdapter interface {
 	// GenerateAddress generates new deposit address
 	GenerateAddress(ctx context.Context) (string, error)
 
+	// ValidateAddress checks address format (and checksum if chain has one) and returns canonical form.
+	// Zero address is rejected.
+	ValidateAddress(address string) (string, error)
+
+	// IsContract reports whether address has code
+	IsContract(ctx context.Context, address string) (bool, error)
+
 	// GetBalance returns balance of address
 	GetBalance(ctx context.Context, address string) (*big.Int, error)
 
-	// SendTransaction sends transaction and returns tx hash
-	SendTransaction(ctx context.Context, fromAddress, toAddress string, amount *big.Int, privateKey string) (string, error)
+	// SendTransaction signs transaction with key provided by withKey, sends it and returns tx hash
+	SendTransaction(ctx context.Context, fromAddress, toAddress string, amount *big.Int, withKey KeyFunc) (string, error)
+
+	// BuildTransaction prepares unsigned transfer (nonce, fee fields) for offline signing.
+	// Gas limit is estimated for contract destinations.
+	BuildTransaction(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*UnsignedTransaction, error)
+
+	// EstimateTransferGas returns gas limit of transfer BuildTransaction would prepare:
+	// 21000 for plain address, estimate with 20% buffer for contract
+	EstimateTransferGas(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (uint64, error)
+
+	// SignTransaction signs unsigned tx with key provided by withKey without sending it
+	SignTransaction(ctx context.Context, unsigned *UnsignedTransaction, withKey KeyFunc) (*SignedTransaction, error)
 
-	// GetTransactionStatus returns transaction status and confirmations
+	// SendRawTransaction broadcasts raw signed tx and returns its hash, tx already known to node is not an error
+	SendRawTransaction(ctx context.Context, rawTx string) (string, error)
+
+	// BroadcastSignedTransaction checks that raw signed tx matches unsigned one and broadcasts it
+	BroadcastSignedTransaction(ctx context.Context, unsigned *UnsignedTransaction, rawTx string) (string, error)
+
+	// GetTransactionStatus returns transaction status and confirmations, ErrTransactionNotFound if node doesn't know tx
 	GetTransactionStatus(ctx context.Context, txHash string) (*TransactionStatus, error)
 
 	// GetLatestBlock returns latest block number
 	GetLatestBlock(ctx context.Context) (int64, error)
 
-	// GetBlockTransactions returns transactions from block
+	// GetTaggedBlock returns number of block with given tag (safe, finalized)
+	GetTaggedBlock(ctx context.Context, tag BlockTag) (int64, error)
+
+	// GetBlockHash returns hash of canonical block at height
+	GetBlockHash(ctx context.Context, blockNumber int64) (string, error)
+
+	// GetBlockTransactions returns native and token transfers from block
 	GetBlockTransactions(ctx context.Context, blockNumber int64) ([]*Transaction, error)
 
 	// GetGasPrice returns current gas price
 	GetGasPrice(ctx context.Context) (*big.Int, error)
+
+	// GetPendingNonceCount returns number of sent but not yet mined transactions of address
+	GetPendingNonceCount(ctx context.Context, address string) (int, error)
+
+	// PaymentURI returns wallet payment link (EIP-681) for sending amount of asset to address.
+	// Zero or nil amount leaves amount to the payer.
+	PaymentURI(address, asset string, amount *big.Int) string
+
+	// WatchPendingTransactions passes mempool transfers to handle until ctx is done or watching fails
+	WatchPendingTransactions(ctx context.Context, mode MempoolMode, handle func(*Transaction)) error
 }
 
+// BlockTag is named block reported by node
+type BlockTag string
+
+const (
+	// BlockTagSafe - block unlikely to be reorged (PoS justified, L2 batch posted)
+	BlockTagSafe BlockTag = "safe"
+	// BlockTagFinalized - block that can't be reverted (PoS finalized, L2 settled on L1)
+	BlockTagFinalized BlockTag = "finalized"
+)
+
+// MempoolMode is how pending transactions are obtained from node
+type MempoolMode string
+
+const (
+	MempoolDisabled MempoolMode = ""
+	// MempoolSubscribe uses eth_subscribe("newPendingTransactions", true), needs websocket RPC
+	MempoolSubscribe MempoolMode = "subscribe"
+	// MempoolTxpool polls txpool_content, node must expose txpool namespace
+	MempoolTxpool MempoolMode = "txpool"
+)
+
+// KeyFunc gives signing code temporary access to hex encoded private key.
+// Key buffer is wiped after use returns, so it must not be retained.
+type KeyFunc func(use func(privateKey []byte) error) error
+
 type TransactionStatus struct {
-	Status       string
-	BlockNumber  int64
+	Status        string
+	BlockNumber   int64
 	Confirmations int
-	Success      bool
+	Success       bool
+	// Fee is network fee paid (gas used * effective gas price), nil while pending
+	Fee *big.Int
 }
 
+// NativeAsset is asset name for chain native coin, tokens are identified by contract address
+const NativeAsset = "native"
+
 type Transaction struct {
 	Hash     string
 	From     string
 	To       string
 	Amount   *big.Int
-	BlockNum int64
+	BlockNum int64  // 0 for pending transactions
+	Asset    string // NativeAsset or token contract address
+	LogIndex int    // -1 for native transfers
+	// BlockTime is timestamp of block, zero for pending transactions
+	BlockTime time.Time
+	// BlockHash is hash of block, "" for pending transactions
+	BlockHash string
 }
 
+// UnsignedTransaction is portable description of transaction to be signed.
+// All big numbers are decimal strings.
+type UnsignedTransaction struct {
+	ChainID  string `json:"chain_id"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`
+	Nonce    uint64 `json:"nonce"`
+	Gas      uint64 `json:"gas"`
+	GasPrice string `json:"gas_price"`
+	Data     string `json:"data"`
+}
+
+// SignedTransaction is raw signed transaction (hex) and its hash
+type SignedTransaction struct {
+	Hash  string `json:"tx_hash"`
+	RawTx string `json:"raw_tx"`
+}
@@ -3,14 +3,21 @@ package adapters
 import (
 	"context"
 	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
+	"time"
 
+	"github.com/dechat/exchange-service/internal/keystore"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 // EVMAdapter implements BlockchainAdapter for EVM-compatible chains
@@ -47,6 +54,66 @@ func (e *EVMAdapter) GenerateAddress(ctx context.Context) (string, error) {
 	return address.Hex(), nil
 }
 
+// GenerateEVMKey generates new private key, returns address and hex encoded key.
+// Caller must wipe returned key buffer.
+func GenerateEVMKey() (string, []byte, error) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	defer wipeECDSA(privateKey)
+
+	raw := crypto.FromECDSA(privateKey)
+	defer keystore.Wipe(raw)
+
+	keyHex := make([]byte, hex.EncodedLen(len(raw)))
+	hex.Encode(keyHex, raw)
+
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+	return address.Hex(), keyHex, nil
+}
+
+// EVMAddressFromKey returns address for hex encoded private key
+func EVMAddressFromKey(privateKeyHex []byte) (string, error) {
+	privateKey, err := parseECDSA(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	defer wipeECDSA(privateKey)
+
+	return crypto.PubkeyToAddress(privateKey.PublicKey).Hex(), nil
+}
+
+// ValidateAddress requires 0x prefixed 20 byte hex address. Mixed-case address
+// must have valid EIP-55 checksum. Returns checksummed address.
+func (e *EVMAdapter) ValidateAddress(address string) (string, error) {
+	digits := strings.TrimPrefix(address, "0x")
+	if len(address) != 2+2*common.AddressLength || len(digits) != 2*common.AddressLength {
+		return "", fmt.Errorf("%w: %q must be 0x followed by 40 hex digits", ErrInvalidAddress, address)
+	}
+	if _, err := hex.DecodeString(digits); err != nil {
+		return "", fmt.Errorf("%w: %q is not hex", ErrInvalidAddress, address)
+	}
+
+	checksummed := common.HexToAddress(address)
+	mixedCase := digits != strings.ToLower(digits) && digits != strings.ToUpper(digits)
+	if mixedCase && checksummed.Hex() != address {
+		return "", fmt.Errorf("%w: %q has invalid EIP-55 checksum", ErrInvalidAddress, address)
+	}
+	if checksummed == (common.Address{}) {
+		return "", fmt.Errorf("%w: zero address", ErrInvalidAddress)
+	}
+	return checksummed.Hex(), nil
+}
+
+func (e *EVMAdapter) IsContract(ctx context.Context, address string) (bool, error) {
+	code, err := e.client.CodeAt(ctx, common.HexToAddress(address), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get code: %w", err)
+	}
+	return len(code) > 0, nil
+}
+
 func (e *EVMAdapter) GetBalance(ctx context.Context, address string) (*big.Int, error) {
 	addr := common.HexToAddress(address)
 	balance, err := e.client.BalanceAt(ctx, addr, nil)
@@ -56,59 +123,152 @@ func (e *EVMAdapter) GetBalance(ctx context.Context, address string) (*big.Int,
 	return balance, nil
 }
 
-func (e *EVMAdapter) SendTransaction(ctx context.Context, fromAddress, toAddress string, amount *big.Int, privateKeyHex string) (string, error) {
-	// Parse private key
-	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+func (e *EVMAdapter) SendTransaction(ctx context.Context, fromAddress, toAddress string, amount *big.Int, withKey KeyFunc) (string, error) {
+	unsigned, err := e.BuildTransaction(ctx, fromAddress, toAddress, amount)
+	if err != nil {
+		return "", err
+	}
+
+	signed, err := e.SignTransaction(ctx, unsigned, withKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Send transaction
+	return e.BroadcastSignedTransaction(ctx, unsigned, signed.RawTx)
+}
+
+func (e *EVMAdapter) SignTransaction(ctx context.Context, unsigned *UnsignedTransaction, withKey KeyFunc) (*SignedTransaction, error) {
+	// Sign transaction, key is only available inside callback
+	var signed *SignedTransaction
+	err := withKey(func(privateKey []byte) error {
+		var err error
+		signed, err = SignTransaction(unsigned, privateKey)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to parse private key: %w", err)
+		return nil, err
 	}
+	return signed, nil
+}
 
+func (e *EVMAdapter) BuildTransaction(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*UnsignedTransaction, error) {
+	if !common.IsHexAddress(toAddress) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAddress, toAddress)
+	}
 	fromAddr := common.HexToAddress(fromAddress)
 	toAddr := common.HexToAddress(toAddress)
 
 	// Get nonce
 	nonce, err := e.client.PendingNonceAt(ctx, fromAddr)
 	if err != nil {
-		return "", fmt.Errorf("failed to get nonce: %w", err)
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
 	}
 
 	// Get gas price
 	gasPrice, err := e.client.SuggestGasPrice(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to get gas price: %w", err)
+		return nil, fmt.Errorf("failed to get gas price: %w", err)
+	}
+
+	gas, err := e.EstimateTransferGas(ctx, fromAddress, toAddress, amount)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create transaction
-	tx := types.NewTransaction(nonce, toAddr, amount, 21000, gasPrice, nil)
+	return &UnsignedTransaction{
+		ChainID:  e.chainID.String(),
+		From:     fromAddr.Hex(),
+		To:       toAddr.Hex(),
+		Value:    amount.String(),
+		Nonce:    nonce,
+		Gas:      gas,
+		GasPrice: gasPrice.String(),
+		Data:     "0x",
+	}, nil
+}
+
+func (e *EVMAdapter) EstimateTransferGas(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (uint64, error) {
+	fromAddr := common.HexToAddress(fromAddress)
+	toAddr := common.HexToAddress(toAddress)
 
-	// Sign transaction
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(e.chainID), privateKey)
+	// Plain transfer costs 21000, contract receiving coins runs code and needs estimate
+	code, err := e.client.CodeAt(ctx, toAddr, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign tx: %w", err)
+		return 0, fmt.Errorf("failed to get code: %w", err)
+	}
+	if len(code) == 0 {
+		return 21000, nil
 	}
 
-	// Send transaction
-	err = e.client.SendTransaction(ctx, signedTx)
+	estimated, err := e.client.EstimateGas(ctx, ethereum.CallMsg{From: fromAddr, To: &toAddr, Value: amount})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "execution reverted"):
+			return 0, fmt.Errorf("failed to estimate gas: %w: %v", ErrExecutionReverted, err)
+		case strings.Contains(err.Error(), "insufficient funds"):
+			return 0, fmt.Errorf("failed to estimate gas: %w: %v", ErrInsufficientFunds, err)
+		}
+		return 0, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+	// 20% buffer, contract state may change before tx is mined
+	return estimated * 6 / 5, nil
+}
+
+func (e *EVMAdapter) BroadcastSignedTransaction(ctx context.Context, unsigned *UnsignedTransaction, rawTx string) (string, error) {
+	if _, err := VerifySignedTransaction(unsigned, rawTx); err != nil {
+		return "", fmt.Errorf("signed tx doesn't match: %w", err)
+	}
+
+	return e.SendRawTransaction(ctx, rawTx)
+}
+
+func (e *EVMAdapter) SendRawTransaction(ctx context.Context, rawTx string) (string, error) {
+	raw, err := hexutil.Decode(rawTx)
 	if err != nil {
+		return "", fmt.Errorf("invalid raw tx: %w", err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return "", fmt.Errorf("failed to decode tx: %w", err)
+	}
+
+	if err := e.client.SendTransaction(ctx, tx); err != nil {
+		// Node errors come back as JSON-RPC messages, not typed errors
+		message := strings.ToLower(err.Error())
+		switch {
+		case strings.Contains(message, "already known"), strings.Contains(message, "known transaction"):
+			// Rebroadcast of tx already in mempool
+			return tx.Hash().Hex(), nil
+		case strings.Contains(message, "nonce too low"):
+			return "", fmt.Errorf("failed to send tx: %w: %v", ErrNonceTooLow, err)
+		case strings.Contains(message, "insufficient funds"):
+			return "", fmt.Errorf("failed to send tx: %w: %v", ErrInsufficientFunds, err)
+		case strings.Contains(message, "invalid sender"):
+			return "", fmt.Errorf("failed to send tx: %w: %v", ErrInvalidSender, err)
+		}
 		return "", fmt.Errorf("failed to send tx: %w", err)
 	}
 
-	return signedTx.Hash().Hex(), nil
+	return tx.Hash().Hex(), nil
 }
 
 func (e *EVMAdapter) GetTransactionStatus(ctx context.Context, txHash string) (*TransactionStatus, error) {
 	hash := common.HexToHash(txHash)
 	_, isPending, err := e.client.TransactionByHash(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, ErrTransactionNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tx: %w", err)
 	}
 
 	if isPending {
 		return &TransactionStatus{
-			Status:       "pending",
-			BlockNumber:  0,
+			Status:        "pending",
+			BlockNumber:   0,
 			Confirmations: 0,
-			Success:      false,
+			Success:       false,
 		}, nil
 	}
 
@@ -125,11 +285,17 @@ func (e *EVMAdapter) GetTransactionStatus(ctx context.Context, txHash string) (*
 
 	confirmations := int(latestBlock - receipt.BlockNumber.Uint64())
 
+	var fee *big.Int
+	if receipt.EffectiveGasPrice != nil {
+		fee = new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+	}
+
 	return &TransactionStatus{
-		Status:       "confirmed",
-		BlockNumber:  receipt.BlockNumber.Int64(),
+		Status:        "confirmed",
+		BlockNumber:   receipt.BlockNumber.Int64(),
 		Confirmations: confirmations,
-		Success:      receipt.Status == 1,
+		Success:       receipt.Status == 1,
+		Fee:           fee,
 	}, nil
 }
 
@@ -141,29 +307,143 @@ func (e *EVMAdapter) GetLatestBlock(ctx context.Context) (int64, error) {
 	return int64(blockNum), nil
 }
 
+func (e *EVMAdapter) GetTaggedBlock(ctx context.Context, tag BlockTag) (int64, error) {
+	var number rpc.BlockNumber
+	switch tag {
+	case BlockTagSafe:
+		number = rpc.SafeBlockNumber
+	case BlockTagFinalized:
+		number = rpc.FinalizedBlockNumber
+	default:
+		return 0, fmt.Errorf("unsupported block tag: %s", tag)
+	}
+
+	header, err := e.client.HeaderByNumber(ctx, big.NewInt(number.Int64()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s block: %w", tag, err)
+	}
+	return header.Number.Int64(), nil
+}
+
+func (e *EVMAdapter) GetBlockHash(ctx context.Context, blockNumber int64) (string, error) {
+	header, err := e.client.HeaderByNumber(ctx, big.NewInt(blockNumber))
+	if err != nil {
+		return "", fmt.Errorf("failed to get block header: %w", err)
+	}
+	return header.Hash().Hex(), nil
+}
+
 func (e *EVMAdapter) GetBlockTransactions(ctx context.Context, blockNumber int64) ([]*Transaction, error) {
 	block, err := e.client.BlockByNumber(ctx, big.NewInt(blockNumber))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get block: %w", err)
 	}
 
+	signer := types.LatestSignerForChainID(e.chainID)
+	blockTime := time.Unix(int64(block.Time()), 0)
+	blockHash := block.Hash()
+
 	var transactions []*Transaction
 	for _, tx := range block.Transactions() {
 		// Only process regular transactions (not contract creation)
-		if tx.To() == nil {
+		if tx.To() == nil || tx.Value().Sign() == 0 {
 			continue
 		}
 
+		var from string
+		if sender, err := types.Sender(signer, tx); err == nil {
+			from = sender.Hex()
+		}
+
 		transactions = append(transactions, &Transaction{
-			Hash:     tx.Hash().Hex(),
-			From:     "", // TODO: get from address
-			To:       tx.To().Hex(),
-			Amount:   tx.Value(),
+			Hash:      tx.Hash().Hex(),
+			From:      from,
+			To:        tx.To().Hex(),
+			Amount:    tx.Value(),
+			BlockNum:  blockNumber,
+			Asset:     NativeAsset,
+			LogIndex:  -1,
+			BlockTime: blockTime,
+			BlockHash: blockHash.Hex(),
+		})
+	}
+
+	// Logs are taken from the same block by hash, block at this height may have changed meanwhile
+	tokenTransfers, err := e.getTokenTransfers(ctx, blockNumber, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, transfer := range tokenTransfers {
+		transfer.BlockTime = blockTime
+		transfer.BlockHash = blockHash.Hex()
+	}
+
+	return append(transactions, tokenTransfers...), nil
+}
+
+// erc20TransferTopic is keccak256("Transfer(address,address,uint256)")
+var erc20TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// getTokenTransfers returns ERC-20 Transfer events from block
+func (e *EVMAdapter) getTokenTransfers(ctx context.Context, blockNumber int64, blockHash common.Hash) ([]*Transaction, error) {
+	logs, err := e.client.FilterLogs(ctx, ethereum.FilterQuery{
+		BlockHash: &blockHash,
+		Topics:    [][]common.Hash{{erc20TransferTopic}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs: %w", err)
+	}
+
+	var transfers []*Transaction
+	for _, l := range logs {
+		// ERC-721 uses same signature with indexed token id (4 topics)
+		if len(l.Topics) != 3 || len(l.Data) != 32 || l.Removed {
+			continue
+		}
+
+		transfers = append(transfers, &Transaction{
+			Hash:     l.TxHash.Hex(),
+			From:     common.BytesToAddress(l.Topics[1].Bytes()).Hex(),
+			To:       common.BytesToAddress(l.Topics[2].Bytes()).Hex(),
+			Amount:   new(big.Int).SetBytes(l.Data),
 			BlockNum: blockNumber,
+			Asset:    l.Address.Hex(),
+			LogIndex: int(l.Index),
 		})
 	}
 
-	return transactions, nil
+	return transfers, nil
+}
+
+// NormalizeAsset returns NativeAsset or checksummed token contract address
+func NormalizeAsset(asset string) (string, error) {
+	if asset == "" || asset == NativeAsset {
+		return NativeAsset, nil
+	}
+	if !common.IsHexAddress(asset) {
+		return "", fmt.Errorf("invalid asset: %s", asset)
+	}
+	return common.HexToAddress(asset).Hex(), nil
+}
+
+// PaymentURI returns EIP-681 URI, e.g. ethereum:0x...@1?value=1000 or
+// ethereum:<token>@1/transfer?address=0x...&uint256=1000 for tokens
+func (e *EVMAdapter) PaymentURI(address, asset string, amount *big.Int) string {
+	hasAmount := amount != nil && amount.Sign() > 0
+
+	if asset == "" || asset == NativeAsset {
+		uri := fmt.Sprintf("ethereum:%s@%s", address, e.chainID)
+		if hasAmount {
+			uri += "?value=" + amount.String()
+		}
+		return uri
+	}
+
+	uri := fmt.Sprintf("ethereum:%s@%s/transfer?address=%s", asset, e.chainID, address)
+	if hasAmount {
+		uri += "&uint256=" + amount.String()
+	}
+	return uri
 }
 
 func (e *EVMAdapter) GetGasPrice(ctx context.Context) (*big.Int, error) {
@@ -174,9 +454,24 @@ func (e *EVMAdapter) GetGasPrice(ctx context.Context) (*big.Int, error) {
 	return gasPrice, nil
 }
 
+func (e *EVMAdapter) GetPendingNonceCount(ctx context.Context, address string) (int, error) {
+	addr := common.HexToAddress(address)
+	pending, err := e.client.PendingNonceAt(ctx, addr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending nonce: %w", err)
+	}
+	mined, err := e.client.NonceAt(ctx, addr, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	if pending < mined {
+		return 0, nil
+	}
+	return int(pending - mined), nil
+}
+
 func (e *EVMAdapter) Close() {
 	if e.client != nil {
 		e.client.Close()
 	}
 }
-
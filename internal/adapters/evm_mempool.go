@@ -0,0 +1,137 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txpoolPollInterval is how often txpool_content is polled
+const txpoolPollInterval = 3 * time.Second
+
+// erc20TransferSelector is first 4 bytes of keccak256("transfer(address,uint256)")
+var erc20TransferSelector = []byte{0xa9, 0x05, 0x9c, 0xbb}
+
+func (e *EVMAdapter) WatchPendingTransactions(ctx context.Context, mode MempoolMode, handle func(*Transaction)) error {
+	switch mode {
+	case MempoolSubscribe:
+		return e.subscribePending(ctx, handle)
+	case MempoolTxpool:
+		return e.pollTxpool(ctx, handle)
+	}
+	return fmt.Errorf("unsupported mempool mode: %q", mode)
+}
+
+func (e *EVMAdapter) subscribePending(ctx context.Context, handle func(*Transaction)) error {
+	ch := make(chan *types.Transaction, 256)
+	sub, err := e.client.Client().EthSubscribe(ctx, ch, "newPendingTransactions", true)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to pending transactions: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	signer := types.LatestSignerForChainID(e.chainID)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-sub.Err():
+			return fmt.Errorf("pending transactions subscription failed: %w", err)
+		case tx := <-ch:
+			if tx.To() == nil {
+				continue
+			}
+			var from common.Address
+			if sender, err := types.Sender(signer, tx); err == nil {
+				from = sender
+			}
+			for _, t := range pendingTransfers(tx.Hash(), from, *tx.To(), tx.Value(), tx.Data()) {
+				handle(t)
+			}
+		}
+	}
+}
+
+// rpcPendingTransaction is transaction as returned by txpool_content
+type rpcPendingTransaction struct {
+	Hash  common.Hash     `json:"hash"`
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+	Input hexutil.Bytes   `json:"input"`
+}
+
+func (e *EVMAdapter) pollTxpool(ctx context.Context, handle func(*Transaction)) error {
+	ticker := time.NewTicker(txpoolPollInterval)
+	defer ticker.Stop()
+
+	// Transactions reported by previous poll, so each one is handled once while it stays in pool
+	seen := make(map[common.Hash]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		var content struct {
+			// sender -> nonce -> tx, queued (nonce gap) transactions are ignored
+			Pending map[string]map[string]*rpcPendingTransaction `json:"pending"`
+		}
+		if err := e.client.Client().CallContext(ctx, &content, "txpool_content"); err != nil {
+			return fmt.Errorf("failed to get txpool content: %w", err)
+		}
+
+		current := make(map[common.Hash]bool, len(seen))
+		for _, txs := range content.Pending {
+			for _, tx := range txs {
+				if tx == nil || tx.To == nil || tx.Value == nil {
+					continue
+				}
+				current[tx.Hash] = true
+				if seen[tx.Hash] {
+					continue
+				}
+				for _, t := range pendingTransfers(tx.Hash, tx.From, *tx.To, tx.Value.ToInt(), tx.Input) {
+					handle(t)
+				}
+			}
+		}
+		seen = current
+	}
+}
+
+// pendingTransfers returns native transfer and ERC-20 transfer() call of pending transaction.
+// Token transfer is decoded from input, the real Transfer event is only known once mined.
+func pendingTransfers(hash common.Hash, from, to common.Address, value *big.Int, input []byte) []*Transaction {
+	var transfers []*Transaction
+	if value.Sign() > 0 {
+		transfers = append(transfers, &Transaction{
+			Hash:     hash.Hex(),
+			From:     from.Hex(),
+			To:       to.Hex(),
+			Amount:   value,
+			Asset:    NativeAsset,
+			LogIndex: -1,
+		})
+	}
+
+	// transfer(address,uint256): selector + 2 words
+	if len(input) == 68 && bytes.Equal(input[:4], erc20TransferSelector) {
+		transfers = append(transfers, &Transaction{
+			Hash:     hash.Hex(),
+			From:     from.Hex(),
+			To:       common.BytesToAddress(input[4:36]).Hex(),
+			Amount:   new(big.Int).SetBytes(input[36:68]),
+			Asset:    to.Hex(),
+			LogIndex: -1,
+		})
+	}
+	return transfers
+}
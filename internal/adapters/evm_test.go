@@ -0,0 +1,80 @@
+package adapters
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	e := &EVMAdapter{chainID: big.NewInt(1)}
+
+	tests := []struct {
+		name    string
+		address string
+		want    string
+		wantErr bool
+	}{
+		// EIP-55 test vectors
+		{name: "checksum 1", address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", want: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		{name: "checksum 2", address: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", want: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"},
+		{name: "checksum 3", address: "0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB", want: "0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB"},
+		{name: "checksum 4", address: "0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb", want: "0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb"},
+		{name: "lowercase", address: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", want: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		{name: "uppercase", address: "0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", want: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		{name: "bad checksum", address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", wantErr: true},
+		{name: "no prefix", address: "5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", wantErr: true},
+		{name: "uppercase prefix", address: "0X5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", wantErr: true},
+		{name: "short", address: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea", wantErr: true},
+		{name: "long", address: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed00", wantErr: true},
+		{name: "not hex", address: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beazz", wantErr: true},
+		{name: "zero", address: "0x0000000000000000000000000000000000000000", wantErr: true},
+		{name: "empty", address: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.ValidateAddress(tt.address)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAddress) {
+					t.Fatalf("expected ErrInvalidAddress, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentURI(t *testing.T) {
+	e := &EVMAdapter{chainID: big.NewInt(137)}
+	address := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	token := "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"
+
+	tests := []struct {
+		name   string
+		asset  string
+		amount *big.Int
+		want   string
+	}{
+		{name: "native", asset: NativeAsset, amount: big.NewInt(1000), want: "ethereum:" + address + "@137?value=1000"},
+		{name: "native empty asset", asset: "", amount: big.NewInt(1000), want: "ethereum:" + address + "@137?value=1000"},
+		{name: "native without amount", asset: NativeAsset, amount: nil, want: "ethereum:" + address + "@137"},
+		{name: "native zero amount", asset: NativeAsset, amount: big.NewInt(0), want: "ethereum:" + address + "@137"},
+		{name: "token", asset: token, amount: big.NewInt(5), want: "ethereum:" + token + "@137/transfer?address=" + address + "&uint256=5"},
+		{name: "token without amount", asset: token, amount: nil, want: "ethereum:" + token + "@137/transfer?address=" + address},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.PaymentURI(address, tt.asset, tt.amount); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
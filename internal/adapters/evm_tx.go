@@ -0,0 +1,159 @@
+package adapters
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/dechat/exchange-service/internal/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signing helpers work without RPC connection so they can be used on air-gapped machine
+
+// SignTransaction signs unsigned EVM transaction with hex encoded private key.
+// Key buffer is not modified, parsed copies are wiped before return.
+func SignTransaction(unsigned *UnsignedTransaction, privateKeyHex []byte) (*SignedTransaction, error) {
+	tx, chainID, err := unsigned.toEVM()
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := parseECDSA(privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeECDSA(privateKey)
+
+	// Catch wrong key before anything is broadcast
+	signer := crypto.PubkeyToAddress(privateKey.PublicKey)
+	if signer != common.HexToAddress(unsigned.From) {
+		return nil, fmt.Errorf("private key is for %s, transaction is from %s", signer.Hex(), unsigned.From)
+	}
+
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign tx: %w", err)
+	}
+
+	raw, err := signedTx.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tx: %w", err)
+	}
+
+	return &SignedTransaction{
+		Hash:  signedTx.Hash().Hex(),
+		RawTx: hexutil.Encode(raw),
+	}, nil
+}
+
+// parseECDSA parses hex encoded key (optional 0x prefix) without making string copies
+func parseECDSA(privateKeyHex []byte) (*ecdsa.PrivateKey, error) {
+	keyHex := bytes.TrimPrefix(bytes.TrimSpace(privateKeyHex), []byte("0x"))
+
+	raw := make([]byte, hex.DecodedLen(len(keyHex)))
+	defer keystore.Wipe(raw)
+
+	if _, err := hex.Decode(raw, keyHex); err != nil {
+		return nil, fmt.Errorf("failed to parse private key: invalid hex")
+	}
+
+	privateKey, err := crypto.ToECDSA(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return privateKey, nil
+}
+
+// wipeECDSA zeroes private scalar of parsed key
+func wipeECDSA(privateKey *ecdsa.PrivateKey) {
+	if privateKey == nil || privateKey.D == nil {
+		return
+	}
+	words := privateKey.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	privateKey.D.SetInt64(0)
+}
+
+// VerifySignedTransaction decodes raw tx and checks that it is exactly unsigned tx signed by From
+func VerifySignedTransaction(unsigned *UnsignedTransaction, rawTx string) (*types.Transaction, error) {
+	expected, chainID, err := unsigned.toEVM()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := hexutil.Decode(rawTx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid raw tx: %w", err)
+	}
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("failed to decode tx: %w", err)
+	}
+
+	switch {
+	case tx.ChainId().Cmp(chainID) != 0:
+		return nil, fmt.Errorf("chain id mismatch: %s != %s", tx.ChainId(), chainID)
+	case tx.Nonce() != expected.Nonce():
+		return nil, fmt.Errorf("nonce mismatch: %d != %d", tx.Nonce(), expected.Nonce())
+	case tx.To() == nil || *tx.To() != *expected.To():
+		return nil, fmt.Errorf("recipient mismatch")
+	case tx.Value().Cmp(expected.Value()) != 0:
+		return nil, fmt.Errorf("value mismatch: %s != %s", tx.Value(), expected.Value())
+	case tx.Gas() != expected.Gas():
+		return nil, fmt.Errorf("gas mismatch: %d != %d", tx.Gas(), expected.Gas())
+	case tx.GasPrice().Cmp(expected.GasPrice()) != 0:
+		return nil, fmt.Errorf("gas price mismatch: %s != %s", tx.GasPrice(), expected.GasPrice())
+	case string(tx.Data()) != string(expected.Data()):
+		return nil, fmt.Errorf("data mismatch")
+	}
+
+	sender, err := types.Sender(types.NewEIP155Signer(chainID), tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover sender: %w", err)
+	}
+	if sender != common.HexToAddress(unsigned.From) {
+		return nil, fmt.Errorf("signed by %s, expected %s", sender.Hex(), unsigned.From)
+	}
+
+	return tx, nil
+}
+
+// toEVM converts portable description to legacy EVM transaction
+func (u *UnsignedTransaction) toEVM() (*types.Transaction, *big.Int, error) {
+	chainID, ok := new(big.Int).SetString(u.ChainID, 10)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid chain id: %s", u.ChainID)
+	}
+	value, ok := new(big.Int).SetString(u.Value, 10)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid value: %s", u.Value)
+	}
+	gasPrice, ok := new(big.Int).SetString(u.GasPrice, 10)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid gas price: %s", u.GasPrice)
+	}
+	if !common.IsHexAddress(u.To) {
+		return nil, nil, fmt.Errorf("invalid recipient: %s", u.To)
+	}
+
+	var data []byte
+	if u.Data != "" && u.Data != "0x" {
+		var err error
+		data, err = hexutil.Decode(u.Data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid data: %w", err)
+		}
+	}
+
+	tx := types.NewTransaction(u.Nonce, common.HexToAddress(u.To), value, u.Gas, gasPrice, data)
+	return tx, chainID, nil
+}
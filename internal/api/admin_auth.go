@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type adminContextKey struct{}
+
+// AdminAuth authenticates admin requests by "Authorization: Bearer <token>".
+// Tokens maps admin name to token, name of matched admin is request's principal.
+func AdminAuth(tokens map[string]string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			// All tokens are compared, so timing doesn't tell which one was close
+			principal := ""
+			for name, expected := range tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+					principal = name
+				}
+			}
+			if principal == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), adminContextKey{}, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// adminPrincipal returns name of admin authenticated by AdminAuth, "" outside of it
+func adminPrincipal(r *http.Request) string {
+	principal, _ := r.Context().Value(adminContextKey{}).(string)
+	return principal
+}
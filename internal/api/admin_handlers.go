@@ -0,0 +1,352 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/offline"
+	"github.com/dechat/exchange-service/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// Admin endpoints, authenticated by AdminAuth
+
+func (h *Handlers) ListWalletTransfers(w http.ResponseWriter, r *http.Request) {
+	chain := models.Chain(r.URL.Query().Get("chain"))
+	if chain == "" {
+		http.Error(w, "chain is required", http.StatusBadRequest)
+		return
+	}
+
+	transfers, err := h.offlineSigningService.ListOpenTransfers(r.Context(), chain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+func (h *Handlers) ExportTransferBundle(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	bundle, err := h.offlineSigningService.ExportBundle(r.Context(), id)
+	if errors.Is(err, storage.ErrTransferStateChanged) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bundle)
+}
+
+func (h *Handlers) ImportSignedTransfer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var signed offline.SignedBundle
+	if err := json.NewDecoder(r.Body).Decode(&signed); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := h.offlineSigningService.ImportSigned(r.Context(), id, &signed)
+	if errors.Is(err, storage.ErrTransferStateChanged) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+func (h *Handlers) ListWrongAssetTransfers(w http.ResponseWriter, r *http.Request) {
+	chain := models.Chain(r.URL.Query().Get("chain"))
+	if chain == "" {
+		http.Error(w, "chain is required", http.StatusBadRequest)
+		return
+	}
+
+	transfers, err := h.walletService.ListWrongAssetTransfers(r.Context(), chain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+// CreateRescanRequest block range to reprocess, inclusive
+type CreateRescanRequest struct {
+	Chain     string `json:"chain"`
+	FromBlock int64  `json:"from_block"`
+	ToBlock   int64  `json:"to_block"`
+}
+
+func (h *Handlers) CreateRescan(w http.ResponseWriter, r *http.Request) {
+	var req CreateRescanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.rescanService.CreateJob(r.Context(), models.Chain(req.Chain), req.FromBlock, req.ToBlock)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *Handlers) ListRescans(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.rescanService.ListJobs(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func (h *Handlers) GetRescan(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.rescanService.GetJob(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *Handlers) ListWithdrawals(w http.ResponseWriter, r *http.Request) {
+	status := models.WithdrawalStatus(r.URL.Query().Get("status"))
+	withdrawals, err := h.withdrawalService.ListWithdrawals(r.Context(), status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withdrawals)
+}
+
+// WithdrawalDecisionRequest reason of decision, required for rejection.
+// Approver is always the authenticated admin.
+type WithdrawalDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *Handlers) ApproveWithdrawal(w http.ResponseWriter, r *http.Request) {
+	h.decideWithdrawal(w, r, models.ApprovalDecisionApproved)
+}
+
+func (h *Handlers) RejectWithdrawal(w http.ResponseWriter, r *http.Request) {
+	h.decideWithdrawal(w, r, models.ApprovalDecisionRejected)
+}
+
+func (h *Handlers) decideWithdrawal(w http.ResponseWriter, r *http.Request, decision models.ApprovalDecision) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	approver := adminPrincipal(r)
+	if approver == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Approval has no required fields, so empty body is fine
+	var req WithdrawalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var withdrawal *models.Withdrawal
+	if decision == models.ApprovalDecisionRejected {
+		withdrawal, err = h.withdrawalService.RejectWithdrawal(r.Context(), id, approver, req.Reason)
+	} else {
+		withdrawal, err = h.withdrawalService.ApproveWithdrawal(r.Context(), id, approver)
+	}
+	if errors.Is(err, storage.ErrOwnWithdrawal) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, storage.ErrNotAwaitingApproval) || errors.Is(err, storage.ErrAlreadyDecided) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withdrawal)
+}
+
+// CancelWithdrawalRequest why withdrawal is cancelled, canceller is the authenticated admin
+type CancelWithdrawalRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CancelWithdrawal cancels withdrawal not yet claimed for sending, otherwise 409
+func (h *Handlers) CancelWithdrawal(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	cancelledBy := adminPrincipal(r)
+	if cancelledBy == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Reason is optional, so empty body is fine
+	var req CancelWithdrawalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	withdrawal, err := h.withdrawalService.CancelWithdrawal(r.Context(), id, cancelledBy, req.Reason)
+	if errors.Is(err, storage.ErrNotCancellable) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withdrawal)
+}
+
+// SetWithdrawalLimitRequest limit of chain asset over rolling window, e.g. "1h" or "24h".
+// UserID is "" for all withdrawals of chain asset together, "*" for every user separately, otherwise single user.
+type SetWithdrawalLimitRequest struct {
+	Chain     string `json:"chain"`
+	Asset     string `json:"asset"`
+	UserID    string `json:"user_id"`
+	Window    string `json:"window"`
+	MaxAmount string `json:"max_amount"`
+}
+
+func (h *Handlers) SetWithdrawalLimit(w http.ResponseWriter, r *http.Request) {
+	var req SetWithdrawalLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	window, err := time.ParseDuration(req.Window)
+	if err != nil {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := h.withdrawalService.SetLimit(r.Context(), models.Chain(req.Chain), req.Asset, req.UserID, window, req.MaxAmount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limit)
+}
+
+// ListWithdrawalLimits returns limits with current usage, ?user_id= shows usage of per user limits
+func (h *Handlers) ListWithdrawalLimits(w http.ResponseWriter, r *http.Request) {
+	limits, err := h.withdrawalService.ListLimits(r.Context(), r.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+func (h *Handlers) DeleteWithdrawalLimit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.withdrawalService.DeleteLimit(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) GetMerchantFeeSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.withdrawalService.GetMerchantFeeSettings(r.Context(), mux.Vars(r)["merchant_id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// SetMerchantFeeSettingsRequest merchant's fee payer policy, "on_top" or "deducted"
+type SetMerchantFeeSettingsRequest struct {
+	FeeMode string `json:"fee_mode"`
+}
+
+func (h *Handlers) SetMerchantFeeSettings(w http.ResponseWriter, r *http.Request) {
+	var req SetMerchantFeeSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.withdrawalService.SetMerchantFeeMode(r.Context(), mux.Vars(r)["merchant_id"], models.FeeMode(req.FeeMode))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
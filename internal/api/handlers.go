@@ -2,37 +2,54 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/qr"
 	"github.com/dechat/exchange-service/internal/services"
+	"github.com/dechat/exchange-service/internal/storage"
 	"github.com/gorilla/mux"
 )
 
 type Handlers struct {
-	walletService     *services.WalletService
-	withdrawalService *services.WithdrawalService
+	walletService         *services.WalletService
+	withdrawalService     *services.WithdrawalService
+	offlineSigningService *services.OfflineSigningService
+	rescanService         *services.RescanService
 }
 
-func NewHandlers(walletService *services.WalletService, withdrawalService *services.WithdrawalService) *Handlers {
+func NewHandlers(walletService *services.WalletService, withdrawalService *services.WithdrawalService, offlineSigningService *services.OfflineSigningService, rescanService *services.RescanService) *Handlers {
 	return &Handlers{
-		walletService:     walletService,
-		withdrawalService: withdrawalService,
+		walletService:         walletService,
+		withdrawalService:     withdrawalService,
+		offlineSigningService: offlineSigningService,
+		rescanService:         rescanService,
 	}
 }
 
 // GenerateDepositAddressRequest request for deposit address generation
 type GenerateDepositAddressRequest struct {
-	Chain   string `json:"chain"`
-	UserID  string `json:"user_id"`
-	OrderID string `json:"order_id"`
+	Chain          string `json:"chain"`
+	UserID         string `json:"user_id"`
+	OrderID        string `json:"order_id"`
+	Asset          string `json:"asset"`           // "native" (default) or token contract address
+	ExpectedAmount string `json:"expected_amount"` // в минимальных единицах (wei)
+	Mode           string `json:"mode"`            // "order" (default) or "static" - permanent address per user
 }
 
 // GenerateDepositAddressResponse response with deposit address
 type GenerateDepositAddressResponse struct {
-	Address string `json:"address"`
-	Chain   string `json:"chain"`
-	OrderID string `json:"order_id"`
+	ID             int64  `json:"id"`
+	Address        string `json:"address"`
+	Chain          string `json:"chain"`
+	OrderID        string `json:"order_id"`
+	Mode           string `json:"mode"`
+	Asset          string `json:"asset"`
+	ExpectedAmount string `json:"expected_amount"`
+	PaymentURI     string `json:"payment_uri"` // EIP-681, render with /api/v1/deposit/{id}/qr
 }
 
 func (h *Handlers) GenerateDepositAddress(w http.ResponseWriter, r *http.Request) {
@@ -43,22 +60,147 @@ func (h *Handlers) GenerateDepositAddress(w http.ResponseWriter, r *http.Request
 	}
 
 	chain := models.Chain(req.Chain)
-	address, err := h.walletService.GenerateDepositAddress(r.Context(), chain, req.UserID, req.OrderID)
+	var deposit *models.Deposit
+	var err error
+	switch models.DepositMode(req.Mode) {
+	case "", models.DepositModeOrder:
+		deposit, err = h.walletService.GenerateDepositAddress(r.Context(), chain, req.UserID, req.OrderID, req.Asset, req.ExpectedAmount)
+	case models.DepositModeStatic:
+		deposit, err = h.walletService.GetStaticAddress(r.Context(), chain, req.UserID)
+	default:
+		http.Error(w, "unknown mode", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	resp := GenerateDepositAddressResponse{
-		Address: address,
-		Chain:   string(chain),
-		OrderID: req.OrderID,
+		ID:             deposit.ID,
+		Address:        deposit.Address,
+		Chain:          string(chain),
+		OrderID:        deposit.OrderID,
+		Mode:           string(deposit.Mode),
+		Asset:          deposit.Asset,
+		ExpectedAmount: deposit.ExpectedAmount,
+		PaymentURI:     deposit.PaymentURI,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+func (h *Handlers) GetDeposit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	deposit, err := h.walletService.GetDeposit(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deposit)
+}
+
+// GetDepositQR renders deposit payment URI as QR code, ?format=png (default) or svg, ?size= in pixels
+func (h *Handlers) GetDepositQR(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	size := 256
+	if v := r.URL.Query().Get("size"); v != "" {
+		size, err = strconv.Atoi(v)
+		if err != nil || size < 64 || size > 2048 {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deposit, err := h.walletService.GetDeposit(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var image []byte
+	var contentType string
+	switch r.URL.Query().Get("format") {
+	case "", "png":
+		image, err = qr.PNG(deposit.PaymentURI, size)
+		contentType = "image/png"
+	case "svg":
+		image, err = qr.SVG(deposit.PaymentURI, size)
+		contentType = "image/svg+xml"
+	default:
+		http.Error(w, "unknown format", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(image)
+}
+
+// GetUserCredits returns transfers to user's static addresses, optional ?chain= filter
+func (h *Handlers) GetUserCredits(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	chain := models.Chain(r.URL.Query().Get("chain"))
+
+	credits, err := h.walletService.GetUserCredits(r.Context(), chain, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(credits)
+}
+
+// ResolveDepositRequest order system decision for underpaid/overpaid deposit
+type ResolveDepositRequest struct {
+	Resolution    string `json:"resolution"` // top_up, refund, accept
+	RefundAddress string `json:"refund_address"`
+}
+
+func (h *Handlers) ResolveDeposit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req ResolveDepositRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	deposit, err := h.walletService.ResolveDeposit(r.Context(), id, models.DepositResolution(req.Resolution), req.RefundAddress)
+	if errors.Is(err, storage.ErrDepositChanged) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deposit)
+}
+
 // GetBalanceResponse response with balance
 type GetBalanceResponse struct {
 	Chain   string `json:"chain"`
@@ -86,10 +228,14 @@ func (h *Handlers) GetBalance(w http.ResponseWriter, r *http.Request) {
 
 // CreateWithdrawalRequest request for withdrawal
 type CreateWithdrawalRequest struct {
-	Chain    string `json:"chain"`
-	OrderID  string `json:"order_id"`
-	ToAddress string `json:"to_address"`
-	Amount   string `json:"amount"`
+	Chain      string     `json:"chain"`
+	MerchantID string     `json:"merchant_id"` // fee mode of merchant applies
+	UserID     string     `json:"user_id"`
+	OrderID    string     `json:"order_id"`
+	ToAddress  string     `json:"to_address"`
+	Amount     string     `json:"amount"`
+	NotBefore  *time.Time `json:"not_before"` // RFC 3339, withdrawal isn't sent earlier
+	Priority   string     `json:"priority"`   // low, normal (default) or urgent
 }
 
 func (h *Handlers) CreateWithdrawal(w http.ResponseWriter, r *http.Request) {
@@ -99,17 +245,173 @@ func (h *Handlers) CreateWithdrawal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chain := models.Chain(req.Chain)
-	withdrawal, err := h.withdrawalService.CreateWithdrawal(r.Context(), chain, req.OrderID, req.ToAddress, req.Amount)
+	// Retried request with the same key returns original withdrawal, order_id is used without header
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+
+	withdrawal, created, err := h.withdrawalService.CreateWithdrawal(r.Context(), services.WithdrawalRequest{
+		Chain:          models.Chain(req.Chain),
+		MerchantID:     req.MerchantID,
+		UserID:         req.UserID,
+		OrderID:        req.OrderID,
+		ToAddress:      req.ToAddress,
+		Amount:         req.Amount,
+		IdempotencyKey: idempotencyKey,
+		NotBefore:      req.NotBefore,
+		Priority:       models.WithdrawalPriority(req.Priority),
+	})
+	if errors.Is(err, storage.ErrIdempotencyConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, storage.ErrLimitExceeded) || errors.Is(err, services.ErrAmountBelowFees) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, services.ErrDestinationNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidDestination) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
 	json.NewEncoder(w).Encode(withdrawal)
 }
 
+// QuoteWithdrawal returns network and service fee estimate for withdrawal under merchant's fee mode
+func (h *Handlers) QuoteWithdrawal(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	chain := models.Chain(query.Get("chain"))
+
+	quote, err := h.withdrawalService.QuoteWithdrawal(r.Context(), chain, query.Get("merchant_id"), query.Get("asset"), query.Get("to_address"), query.Get("amount"), models.WithdrawalPriority(query.Get("priority")))
+	if errors.Is(err, services.ErrAmountBelowFees) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// GetWithdrawal returns withdrawal with its history (retries, failure reason)
+func (h *Handlers) GetWithdrawal(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	withdrawal, err := h.withdrawalService.GetWithdrawal(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withdrawal)
+}
+
+func (h *Handlers) ListWithdrawalAddresses(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	chain := models.Chain(r.URL.Query().Get("chain"))
+
+	addresses, err := h.withdrawalService.ListAddresses(r.Context(), userID, chain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(addresses)
+}
+
+// AddWithdrawalAddressRequest address book entry, label is shown instead of address in reports
+type AddWithdrawalAddressRequest struct {
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+	Label   string `json:"label"`
+}
+
+func (h *Handlers) AddWithdrawalAddress(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var req AddWithdrawalAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	address, err := h.withdrawalService.AddAddress(r.Context(), userID, models.Chain(req.Chain), req.Address, req.Label)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(address)
+}
+
+func (h *Handlers) DeleteWithdrawalAddress(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.withdrawalService.DeleteAddress(r.Context(), userID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) GetWithdrawalSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.withdrawalService.GetSettings(r.Context(), mux.Vars(r)["user_id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// SetWithdrawalSettingsRequest user's withdrawal settings
+type SetWithdrawalSettingsRequest struct {
+	WhitelistOnly bool `json:"whitelist_only"`
+}
+
+func (h *Handlers) SetWithdrawalSettings(w http.ResponseWriter, r *http.Request) {
+	var req SetWithdrawalSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.withdrawalService.SetWhitelistOnly(r.Context(), mux.Vars(r)["user_id"], req.WhitelistOnly)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
 // GetTransactionRequest request for transaction status
 type GetTransactionRequest struct {
 	Chain  string `json:"chain"`
@@ -120,4 +422,3 @@ func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
-
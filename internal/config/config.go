@@ -3,12 +3,19 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Chains   map[string]ChainConfig
+	Server     ServerConfig
+	Database   DatabaseConfig
+	Chains     map[string]ChainConfig
+	Keys       KeysConfig
+	Withdrawal WithdrawalConfig
+	Deposit    DepositConfig
+	Admin      AdminConfig
 }
 
 type ServerConfig struct {
@@ -25,10 +32,91 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// DSN returns postgres connection string
+func (c DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		c.Host,
+		c.Port,
+		c.User,
+		c.Password,
+		c.DBName,
+		c.SSLMode,
+	)
+}
+
+// KeysConfig holds key management settings
+type KeysConfig struct {
+	// EncryptionKey is hex encoded AES-256 key used to encrypt hot wallet keys
+	EncryptionKey string
+}
+
+// AdminConfig holds admin API settings
+type AdminConfig struct {
+	// Tokens maps admin name to bearer token, admin API rejects all requests when empty
+	Tokens map[string]string
+}
+
+// WithdrawalConfig holds withdrawal processing settings
+type WithdrawalConfig struct {
+	// WalletStrategy is hot wallet selection strategy: balance, least_pending, round_robin
+	WalletStrategy string
+	// Withdrawals to ApprovalDestinations or from ApprovalUsers always need approval
+	ApprovalDestinations []string
+	ApprovalUsers        []string
+	// RequiredApprovals is number of distinct approvers for withdrawal awaiting approval
+	RequiredApprovals int
+	// AddressCooldown is delay before new address book entry can be used or whitelist-only is turned off
+	AddressCooldown time.Duration
+	// WhitelistMerchants must send user id with every withdrawal
+	WhitelistMerchants []string
+	// ContractDestinations is "allow" (gas limit is estimated) or "reject"
+	ContractDestinations string
+	// UrgentGasPricePercent is gas price of urgent withdrawals in percent of suggested one
+	UrgentGasPricePercent int
+	// LowPriorityMaxDelay is how long low priority withdrawal waits for cheap gas at most
+	LowPriorityMaxDelay time.Duration
+}
+
+// DepositConfig holds deposit matching settings
+type DepositConfig struct {
+	// ToleranceBPS is allowed difference from expected amount in basis points,
+	// payments within it are treated as exact
+	ToleranceBPS int
+	// TTL is how long unpaid deposit stays open, 0 disables expiry
+	TTL time.Duration
+	// LateGracePeriod is how long address is still watched after expiry
+	LateGracePeriod time.Duration
+	// AddressPoolSize is number of pre-generated addresses kept per chain, 0 disables pool
+	AddressPoolSize int
+	// AddressBloom keeps watched addresses in bloom filter instead of exact set
+	AddressBloom bool
+}
+
 type ChainConfig struct {
-	RPCURL      string
-	ChainID     int64
+	RPCURL           string
+	ChainID          int64
 	MinConfirmations int
+	// ConfirmationPolicy is "blocks" (MinConfirmations), "safe" or "finalized" block tag
+	ConfirmationPolicy string
+	// MempoolMode enables pending deposit detection: "" (off), "subscribe" or "txpool"
+	MempoolMode string
+	// ApprovalThreshold - withdrawals of at least this amount (wei) need approval, empty disables
+	ApprovalThreshold string
+	Rebalance         RebalanceConfig
+	// ServiceFee (wei) plus ServiceFeeBPS of amount is our withdrawal fee, paid per merchant's fee mode
+	ServiceFee    string
+	ServiceFeeBPS int
+	// LowPriorityMaxGasPrice - low priority withdrawals wait while gas price (wei) is above it, empty disables
+	LowPriorityMaxGasPrice string
+}
+
+// RebalanceConfig holds hot/cold balance thresholds for chain (wei).
+// Empty ColdAddress disables rebalancing.
+type RebalanceConfig struct {
+	MinBalance    string
+	TargetBalance string
+	MaxBalance    string
+	ColdAddress   string
 }
 
 func Load() (*Config, error) {
@@ -46,6 +134,41 @@ func Load() (*Config, error) {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		Chains: make(map[string]ChainConfig),
+		Keys: KeysConfig{
+			EncryptionKey: getEnv("KEY_ENCRYPTION_KEY", ""),
+		},
+		Withdrawal: WithdrawalConfig{
+			WalletStrategy:        getEnv("WITHDRAWAL_WALLET_STRATEGY", "balance"),
+			ApprovalDestinations:  getEnvList("WITHDRAWAL_APPROVAL_DESTINATIONS"),
+			ApprovalUsers:         getEnvList("WITHDRAWAL_APPROVAL_USERS"),
+			RequiredApprovals:     getEnvInt("WITHDRAWAL_REQUIRED_APPROVALS", 2),
+			AddressCooldown:       getEnvDuration("WITHDRAWAL_ADDRESS_COOLDOWN", 24*time.Hour),
+			WhitelistMerchants:    getEnvList("WITHDRAWAL_WHITELIST_MERCHANTS"),
+			ContractDestinations:  getEnv("WITHDRAWAL_CONTRACT_DESTINATIONS", "allow"),
+			UrgentGasPricePercent: getEnvInt("WITHDRAWAL_URGENT_GAS_PRICE_PERCENT", 150),
+			LowPriorityMaxDelay:   getEnvDuration("WITHDRAWAL_LOW_PRIORITY_MAX_DELAY", 24*time.Hour),
+		},
+		Deposit: DepositConfig{
+			ToleranceBPS:    getEnvInt("DEPOSIT_TOLERANCE_BPS", 0),
+			TTL:             getEnvDuration("DEPOSIT_TTL", 24*time.Hour),
+			LateGracePeriod: getEnvDuration("DEPOSIT_LATE_GRACE_PERIOD", 72*time.Hour),
+			AddressPoolSize: getEnvInt("DEPOSIT_ADDRESS_POOL_SIZE", 100),
+			AddressBloom:    getEnvBool("DEPOSIT_ADDRESS_BLOOM", false),
+		},
+	}
+
+	// ADMIN_TOKENS is comma separated name:token list
+	cfg.Admin.Tokens = make(map[string]string)
+	for _, entry := range getEnvList("ADMIN_TOKENS") {
+		name, token, ok := strings.Cut(entry, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("invalid ADMIN_TOKENS entry, expected name:token")
+		}
+		if _, exists := cfg.Admin.Tokens[name]; exists {
+			return nil, fmt.Errorf("duplicate admin name in ADMIN_TOKENS: %s", name)
+		}
+		cfg.Admin.Tokens[name] = token
 	}
 
 	// Load chain configs
@@ -54,9 +177,21 @@ func Load() (*Config, error) {
 		rpcURL := getEnv(fmt.Sprintf("%s_RPC_URL", chain), "")
 		if rpcURL != "" {
 			cfg.Chains[chain] = ChainConfig{
-				RPCURL:          rpcURL,
-				ChainID:         getEnvInt64(fmt.Sprintf("%s_CHAIN_ID", chain), 0),
-				MinConfirmations: getEnvInt(fmt.Sprintf("%s_MIN_CONFIRMATIONS", chain), 1),
+				RPCURL:             rpcURL,
+				ChainID:            getEnvInt64(fmt.Sprintf("%s_CHAIN_ID", chain), 0),
+				MinConfirmations:   getEnvInt(fmt.Sprintf("%s_MIN_CONFIRMATIONS", chain), 1),
+				ConfirmationPolicy: getEnv(fmt.Sprintf("%s_CONFIRMATION_POLICY", chain), "blocks"),
+				MempoolMode:        getEnv(fmt.Sprintf("%s_MEMPOOL_MODE", chain), ""),
+				ApprovalThreshold:  getEnv(fmt.Sprintf("%s_WITHDRAWAL_APPROVAL_THRESHOLD", chain), ""),
+				Rebalance: RebalanceConfig{
+					MinBalance:    getEnv(fmt.Sprintf("%s_HOT_MIN_BALANCE", chain), ""),
+					TargetBalance: getEnv(fmt.Sprintf("%s_HOT_TARGET_BALANCE", chain), ""),
+					MaxBalance:    getEnv(fmt.Sprintf("%s_HOT_MAX_BALANCE", chain), ""),
+					ColdAddress:   getEnv(fmt.Sprintf("%s_COLD_ADDRESS", chain), ""),
+				},
+				ServiceFee:             getEnv(fmt.Sprintf("%s_WITHDRAWAL_SERVICE_FEE", chain), ""),
+				ServiceFeeBPS:          getEnvInt(fmt.Sprintf("%s_WITHDRAWAL_SERVICE_FEE_BPS", chain), 0),
+				LowPriorityMaxGasPrice: getEnv(fmt.Sprintf("%s_WITHDRAWAL_LOW_PRIORITY_MAX_GAS_PRICE", chain), ""),
 			}
 		}
 	}
@@ -72,12 +207,48 @@ func getEnv(key, defaultValue string) string {
 }
 
 func getEnvInt(key string, defaultValue int) int {
-	// TODO: parse int from env
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
 	return defaultValue
 }
 
 func getEnvInt64(key string, defaultValue int64) int64 {
-	// TODO: parse int64 from env
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
 	return defaultValue
 }
 
+// getEnvList returns comma separated values, empty ones are skipped
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,114 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Keystore encrypts and decrypts hot wallet private keys (TODO: use HSM)
+type Keystore struct {
+	encKey []byte
+}
+
+// New creates keystore with 32 byte AES-256 key
+func New(encKey []byte) (*Keystore, error) {
+	if len(encKey) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(encKey))
+	}
+	return &Keystore{encKey: encKey}, nil
+}
+
+// NewFromHex creates keystore from hex encoded key
+func NewFromHex(hexKey string) (*Keystore, error) {
+	encKey, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return New(encKey)
+}
+
+// NewEphemeral creates keystore with random key.
+// Keys encrypted with it can't be decrypted after restart.
+func NewEphemeral() *Keystore {
+	encKey := make([]byte, 32)
+	rand.Read(encKey)
+	return &Keystore{encKey: encKey}
+}
+
+// Encrypt encrypts private key, returns hex(nonce || ciphertext).
+// Caller still owns key buffer and should Wipe it.
+func (k *Keystore) Encrypt(key []byte) (string, error) {
+	block, err := aes.NewCipher(k.encKey)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, key, nil)
+	return hex.EncodeToString(ciphertext), nil
+}
+
+// WithKey decrypts private key, passes it to use and wipes it when use returns.
+// use must not retain the buffer.
+func (k *Keystore) WithKey(encryptedHex string, use func(privateKey []byte) error) error {
+	key, err := k.decrypt(encryptedHex)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	defer Wipe(key)
+
+	return use(key)
+}
+
+// KeyFunc binds encrypted key to WithKey, so it can be handed to signing code
+// (see adapters.KeyFunc) without exposing plaintext to the caller
+func (k *Keystore) KeyFunc(encryptedHex string) func(use func(privateKey []byte) error) error {
+	return func(use func(privateKey []byte) error) error {
+		return k.WithKey(encryptedHex, use)
+	}
+}
+
+func (k *Keystore) decrypt(encryptedHex string) ([]byte, error) {
+	ciphertext, err := hex.DecodeString(encryptedHex)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(k.encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// Wipe overwrites buffer with zeros
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
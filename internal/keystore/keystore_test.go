@@ -0,0 +1,90 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWithKeyWipesBuffer(t *testing.T) {
+	ks := NewEphemeral()
+	key := []byte("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+
+	encrypted, err := ks.Encrypt(key)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	var seen []byte
+	err = ks.WithKey(encrypted, func(privateKey []byte) error {
+		if !bytes.Equal(privateKey, key) {
+			t.Fatalf("decrypted key mismatch")
+		}
+		seen = privateKey // retained only to check it after return
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("with key: %v", err)
+	}
+
+	if len(seen) != len(key) {
+		t.Fatalf("unexpected key length %d", len(seen))
+	}
+	if !isZero(seen) {
+		t.Fatalf("key buffer not wiped: %x", seen)
+	}
+}
+
+func TestWithKeyWipesBufferOnError(t *testing.T) {
+	ks := NewEphemeral()
+	encrypted, err := ks.Encrypt([]byte("deadbeef"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	errSign := errors.New("sign failed")
+	var seen []byte
+	err = ks.KeyFunc(encrypted)(func(privateKey []byte) error {
+		seen = privateKey
+		return errSign
+	})
+	if !errors.Is(err, errSign) {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+	if !isZero(seen) {
+		t.Fatalf("key buffer not wiped: %x", seen)
+	}
+}
+
+func TestWithKeyWrongEncryptionKey(t *testing.T) {
+	encrypted, err := NewEphemeral().Encrypt([]byte("deadbeef"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	called := false
+	err = NewEphemeral().WithKey(encrypted, func([]byte) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Fatalf("expected decrypt error without calling use, got err=%v called=%v", err, called)
+	}
+}
+
+func TestWipe(t *testing.T) {
+	b := []byte{1, 2, 3, 4}
+	Wipe(b)
+	if !isZero(b) {
+		t.Fatalf("buffer not wiped: %v", b)
+	}
+}
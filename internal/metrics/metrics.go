@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Deposit address pool
+var (
+	AddressPoolAvailable = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "deposit_address_pool_available",
+		Help: "Pre-generated deposit addresses not assigned yet",
+	}, []string{"chain"})
+
+	AddressPoolTarget = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "deposit_address_pool_target",
+		Help: "Configured deposit address pool size",
+	}, []string{"chain"})
+
+	AddressPoolClaims = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "deposit_address_pool_claims_total",
+		Help: "Deposit addresses taken from pool",
+	}, []string{"chain"})
+
+	AddressPoolMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "deposit_address_pool_misses_total",
+		Help: "Deposit addresses generated in request path because pool was empty",
+	}, []string{"chain"})
+
+	AddressPoolRefillErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "deposit_address_pool_refill_errors_total",
+		Help: "Failed deposit address pool refills",
+	}, []string{"chain"})
+)
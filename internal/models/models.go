@@ -17,64 +17,347 @@ const (
 type DepositStatus string
 
 const (
-	DepositStatusPending   DepositStatus = "pending"
+	DepositStatusPending DepositStatus = "pending"
+	// DepositStatusDetected - payment seen (mempool or unconfirmed block), not credited yet
+	DepositStatusDetected  DepositStatus = "detected"
 	DepositStatusConfirmed DepositStatus = "confirmed"
 	DepositStatusExpired   DepositStatus = "expired"
+	// Confirmed deposit compared to expected amount (within tolerance)
+	DepositStatusUnderpaid DepositStatus = "underpaid"
+	DepositStatusPaid      DepositStatus = "paid"
+	DepositStatusOverpaid  DepositStatus = "overpaid"
+	// DepositStatusLate - funds arrived only after deposit expired
+	DepositStatusLate DepositStatus = "late"
+)
+
+// DepositMode defines how deposit address is used
+type DepositMode string
+
+const (
+	// DepositModeOrder - fresh address for every order, paid amount is matched against expected amount
+	DepositModeOrder DepositMode = "order"
+	// DepositModeStatic - permanent address per user and chain, every transfer is user credit
+	DepositModeStatic DepositMode = "static"
+)
+
+// DepositResolution is order system decision for under/overpaid deposit
+type DepositResolution string
+
+const (
+	DepositResolutionNone DepositResolution = ""
+	// DepositResolutionTopUp keeps waiting for the rest of payment (underpaid only)
+	DepositResolutionTopUp  DepositResolution = "top_up"
+	DepositResolutionRefund DepositResolution = "refund"
+	DepositResolutionAccept DepositResolution = "accept"
 )
 
 // WithdrawalStatus represents withdrawal status
 type WithdrawalStatus string
 
 const (
-	WithdrawalStatusPending   WithdrawalStatus = "pending"
-	WithdrawalStatusSent      WithdrawalStatus = "sent"
-	WithdrawalStatusConfirmed WithdrawalStatus = "confirmed"
-	WithdrawalStatusFailed    WithdrawalStatus = "failed"
+	WithdrawalStatusPending WithdrawalStatus = "pending"
+	// WithdrawalStatusProcessing - claimed by instance holding the lease, tx may be signed or broadcast
+	WithdrawalStatusProcessing WithdrawalStatus = "processing"
+	WithdrawalStatusSent       WithdrawalStatus = "sent"
+	WithdrawalStatusConfirmed  WithdrawalStatus = "confirmed"
+	WithdrawalStatusFailed     WithdrawalStatus = "failed"
+	// WithdrawalStatusAwaitingApproval - matched approval policy, becomes pending once approved
+	WithdrawalStatusAwaitingApproval WithdrawalStatus = "awaiting_approval"
+	WithdrawalStatusRejected         WithdrawalStatus = "rejected"
+	// WithdrawalStatusCancelled - cancelled while pending or awaiting approval, never sent
+	WithdrawalStatusCancelled WithdrawalStatus = "cancelled"
+)
+
+// WithdrawalPriority orders withdrawal queue and sets how aggressive gas price is
+type WithdrawalPriority string
+
+const (
+	// WithdrawalPriorityLow - sent last, waits for cheap gas
+	WithdrawalPriorityLow    WithdrawalPriority = "low"
+	WithdrawalPriorityNormal WithdrawalPriority = "normal"
+	// WithdrawalPriorityUrgent - sent first with increased gas price
+	WithdrawalPriorityUrgent WithdrawalPriority = "urgent"
+)
+
+// ApprovalDecision represents approver decision on withdrawal
+type ApprovalDecision string
+
+const (
+	ApprovalDecisionApproved ApprovalDecision = "approved"
+	ApprovalDecisionRejected ApprovalDecision = "rejected"
+)
+
+// WithdrawalEventType represents kind of withdrawal history entry
+type WithdrawalEventType string
+
+const (
+	// WithdrawalEventRetry - transient error, withdrawal is retried after backoff
+	WithdrawalEventRetry     WithdrawalEventType = "retry"
+	WithdrawalEventFailed    WithdrawalEventType = "failed"
+	WithdrawalEventSent      WithdrawalEventType = "sent"
+	WithdrawalEventConfirmed WithdrawalEventType = "confirmed"
+	// WithdrawalEventApprovalRequired - withdrawal matched approval policy
+	WithdrawalEventApprovalRequired WithdrawalEventType = "approval_required"
+	WithdrawalEventApproved         WithdrawalEventType = "approved"
+	WithdrawalEventRejected         WithdrawalEventType = "rejected"
+	// WithdrawalEventFeeReconciled - actual network fee compared with quote after confirmation
+	WithdrawalEventFeeReconciled WithdrawalEventType = "fee_reconciled"
+	WithdrawalEventCancelled     WithdrawalEventType = "cancelled"
+)
+
+// FeeMode defines who pays withdrawal fees, chosen by merchant
+type FeeMode string
+
+const (
+	// FeeModeOnTop - recipient gets full amount, fees are charged to merchant on top of it
+	FeeModeOnTop FeeMode = "on_top"
+	// FeeModeDeducted - fees are deducted from amount, recipient gets the rest
+	FeeModeDeducted FeeMode = "deducted"
+)
+
+// HotWalletStatus represents hot wallet lifecycle status
+type HotWalletStatus string
+
+const (
+	HotWalletStatusActive  HotWalletStatus = "active"
+	HotWalletStatusRetired HotWalletStatus = "retired"
+)
+
+// WalletTransferDirection represents direction of hot/cold rebalancing transfer
+type WalletTransferDirection string
+
+const (
+	WalletTransferHotToCold WalletTransferDirection = "hot_to_cold"
+	WalletTransferColdToHot WalletTransferDirection = "cold_to_hot"
+)
+
+// WalletTransferStatus represents rebalancing transfer status
+type WalletTransferStatus string
+
+const (
+	// WalletTransferStatusRequested - waiting to be sent (cold wallet is signed offline)
+	WalletTransferStatusRequested WalletTransferStatus = "requested"
+	// WalletTransferStatusExported - bundle exported for offline signing, waiting for signed import
+	WalletTransferStatusExported  WalletTransferStatus = "exported"
+	WalletTransferStatusSent      WalletTransferStatus = "sent"
+	WalletTransferStatusConfirmed WalletTransferStatus = "confirmed"
+	WalletTransferStatusFailed    WalletTransferStatus = "failed"
+)
+
+// RescanJobStatus represents block range rescan status
+type RescanJobStatus string
+
+const (
+	RescanJobStatusQueued    RescanJobStatus = "queued"
+	RescanJobStatusRunning   RescanJobStatus = "running"
+	RescanJobStatusCompleted RescanJobStatus = "completed"
+	RescanJobStatusFailed    RescanJobStatus = "failed"
 )
 
 // Deposit represents user deposit
 type Deposit struct {
-	ID             int64         `db:"id" json:"id"`
-	Chain          Chain         `db:"chain" json:"chain"`
-	Address        string        `db:"address" json:"address"`
-	UserID         string        `db:"user_id" json:"user_id"`
-	OrderID        string        `db:"order_id" json:"order_id"`
-	ExpectedAmount string        `db:"expected_amount" json:"expected_amount"`
-	ReceivedAmount string        `db:"received_amount" json:"received_amount"`
-	TxHash         string        `db:"tx_hash" json:"tx_hash"`
-	BlockNumber    int64         `db:"block_number" json:"block_number"`
-	Confirmations  int           `db:"confirmations" json:"confirmations"`
-	Status         DepositStatus `db:"status" json:"status"`
-	CreatedAt      time.Time     `db:"created_at" json:"created_at"`
-	ConfirmedAt    *time.Time    `db:"confirmed_at" json:"confirmed_at"`
+	ID                 int64             `db:"id" json:"id"`
+	Chain              Chain             `db:"chain" json:"chain"`
+	Address            string            `db:"address" json:"address"`
+	UserID             string            `db:"user_id" json:"user_id"`
+	OrderID            string            `db:"order_id" json:"order_id"`
+	Mode               DepositMode       `db:"mode" json:"mode"`
+	Asset              string            `db:"asset" json:"asset"`
+	ExpectedAmount     string            `db:"expected_amount" json:"expected_amount"`
+	ReceivedAmount     string            `db:"received_amount" json:"received_amount"`
+	TxHash             string            `db:"tx_hash" json:"tx_hash"`
+	BlockNumber        int64             `db:"block_number" json:"block_number"`
+	Confirmations      int               `db:"confirmations" json:"confirmations"`
+	Status             DepositStatus     `db:"status" json:"status"`
+	Resolution         DepositResolution `db:"resolution" json:"resolution"`
+	RefundAddress      string            `db:"refund_address" json:"refund_address,omitempty"`
+	RefundAmount       string            `db:"refund_amount" json:"refund_amount"`
+	RefundWithdrawalID *int64            `db:"refund_withdrawal_id" json:"refund_withdrawal_id,omitempty"`
+	CreatedAt          time.Time         `db:"created_at" json:"created_at"`
+	ConfirmedAt        *time.Time        `db:"confirmed_at" json:"confirmed_at"`
+	ResolvedAt         *time.Time        `db:"resolved_at" json:"resolved_at,omitempty"`
+	ExpiresAt          *time.Time        `db:"expires_at" json:"expires_at,omitempty"`
+	WatchUntil         *time.Time        `db:"watch_until" json:"watch_until,omitempty"` // address is watched for late payments until then
+	DetectedTxHash     string            `db:"detected_tx_hash" json:"detected_tx_hash,omitempty"`
+	DetectedAt         *time.Time        `db:"detected_at" json:"detected_at,omitempty"`
+
+	Transfers  []*DepositTransfer `db:"-" json:"transfers,omitempty"`
+	PaymentURI string             `db:"-" json:"payment_uri,omitempty"` // EIP-681
+}
+
+// DepositTransfer represents single incoming transfer to deposit address
+type DepositTransfer struct {
+	ID            int64  `db:"id" json:"id"`
+	DepositID     int64  `db:"deposit_id" json:"deposit_id"`
+	Chain         Chain  `db:"chain" json:"chain"`
+	TxHash        string `db:"tx_hash" json:"tx_hash"`
+	LogIndex      int    `db:"log_index" json:"log_index"` // -1 for native transfers
+	FromAddress   string `db:"from_address" json:"from_address"`
+	Asset         string `db:"asset" json:"asset"`
+	Amount        string `db:"amount" json:"amount"`
+	BlockNumber   int64  `db:"block_number" json:"block_number"`
+	BlockHash     string `db:"block_hash" json:"block_hash"`
+	Confirmations int    `db:"confirmations" json:"confirmations"`
+	Confirmed     bool   `db:"confirmed" json:"confirmed"`
+	Late          bool   `db:"late" json:"late"` // arrived after deposit expired
+	// WrongAsset - other asset than deposit expects, not counted towards deposit
+	WrongAsset  bool       `db:"wrong_asset" json:"wrong_asset"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	ConfirmedAt *time.Time `db:"confirmed_at" json:"confirmed_at"`
 }
 
 // Withdrawal represents user withdrawal
 type Withdrawal struct {
-	ID            int64            `db:"id" json:"id"`
-	Chain         Chain            `db:"chain" json:"chain"`
-	OrderID       string           `db:"order_id" json:"order_id"`
-	FromAddress   string           `db:"from_address" json:"from_address"`
-	ToAddress     string           `db:"to_address" json:"to_address"`
-	Amount        string           `db:"amount" json:"amount"`
-	Fee           string           `db:"fee" json:"fee"`
-	TxHash        string           `db:"tx_hash" json:"tx_hash"`
-	Status        WithdrawalStatus `db:"status" json:"status"`
-	BlockNumber   int64            `db:"block_number" json:"block_number"`
-	Confirmations int              `db:"confirmations" json:"confirmations"`
-	CreatedAt     time.Time        `db:"created_at" json:"created_at"`
-	SentAt        *time.Time       `db:"sent_at" json:"sent_at"`
-	ConfirmedAt   *time.Time       `db:"confirmed_at" json:"confirmed_at"`
+	ID             int64            `db:"id" json:"id"`
+	Chain          Chain            `db:"chain" json:"chain"`
+	UserID         string           `db:"user_id" json:"user_id,omitempty"`
+	OrderID        string           `db:"order_id" json:"order_id"`
+	IdempotencyKey string           `db:"idempotency_key" json:"idempotency_key,omitempty"`
+	FromAddress    string           `db:"from_address" json:"from_address"`
+	ToAddress      string           `db:"to_address" json:"to_address"`
+	ToLabel        string           `db:"to_label" json:"to_label,omitempty"` // address book label
+	ToContract     bool             `db:"to_contract" json:"to_contract"`
+	Asset          string           `db:"asset" json:"asset"` // only native coin is sent for now
+	Amount         string           `db:"amount" json:"amount"`
+	Fee            string           `db:"fee" json:"fee"`
+	TxHash         string           `db:"tx_hash" json:"tx_hash"`
+	Status         WithdrawalStatus `db:"status" json:"status"`
+	BlockNumber    int64            `db:"block_number" json:"block_number"`
+	Confirmations  int              `db:"confirmations" json:"confirmations"`
+	CreatedAt      time.Time        `db:"created_at" json:"created_at"`
+	SentAt         *time.Time       `db:"sent_at" json:"sent_at"`
+	ConfirmedAt    *time.Time       `db:"confirmed_at" json:"confirmed_at"`
+	LeaseOwner     string           `db:"lease_owner" json:"-"`
+	LeaseExpiresAt *time.Time       `db:"lease_expires_at" json:"-"`
+	RawTx          string           `db:"raw_tx" json:"-"` // signed tx, saved before broadcast
+	Attempts       int              `db:"attempts" json:"attempts"`
+	NextAttemptAt  *time.Time       `db:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	LastError      string           `db:"last_error" json:"last_error,omitempty"`
+	FailureReason  string           `db:"failure_reason" json:"failure_reason,omitempty"`
+	// RequiredApprovals is number of distinct approvers needed, 0 when no approval is required
+	RequiredApprovals int    `db:"required_approvals" json:"required_approvals,omitempty"`
+	ApprovalReason    string `db:"approval_reason" json:"approval_reason,omitempty"`
+	// Fees quoted at creation, Fee is replaced with actual network fee once mined
+	MerchantID    string  `db:"merchant_id" json:"merchant_id,omitempty"`
+	FeeMode       FeeMode `db:"fee_mode" json:"fee_mode"`
+	QuotedFee     string  `db:"quoted_fee" json:"quoted_fee"`
+	ServiceFee    string  `db:"service_fee" json:"service_fee"`
+	ReceiveAmount string  `db:"receive_amount" json:"receive_amount"` // amount sent to recipient
+	// NotBefore schedules withdrawal, it isn't sent earlier
+	NotBefore *time.Time         `db:"not_before" json:"not_before,omitempty"`
+	Priority  WithdrawalPriority `db:"priority" json:"priority"`
+
+	Events    []*WithdrawalEvent    `db:"-" json:"events,omitempty"`
+	Approvals []*WithdrawalApproval `db:"-" json:"approvals,omitempty"`
+}
+
+// WithdrawalApproval represents approver decision, it's audit trail of approvals
+type WithdrawalApproval struct {
+	ID           int64            `db:"id" json:"id"`
+	WithdrawalID int64            `db:"withdrawal_id" json:"withdrawal_id"`
+	Approver     string           `db:"approver" json:"approver"`
+	Decision     ApprovalDecision `db:"decision" json:"decision"`
+	Reason       string           `db:"reason" json:"reason,omitempty"`
+	CreatedAt    time.Time        `db:"created_at" json:"created_at"`
+}
+
+// WithdrawalEvent represents withdrawal history entry
+type WithdrawalEvent struct {
+	ID           int64               `db:"id" json:"id"`
+	WithdrawalID int64               `db:"withdrawal_id" json:"withdrawal_id"`
+	Type         WithdrawalEventType `db:"type" json:"type"`
+	Message      string              `db:"message" json:"message,omitempty"`
+	CreatedAt    time.Time           `db:"created_at" json:"created_at"`
+}
+
+// WithdrawalAddress represents user's address book entry
+type WithdrawalAddress struct {
+	ID          int64     `db:"id" json:"id"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	Chain       Chain     `db:"chain" json:"chain"`
+	Address     string    `db:"address" json:"address"`
+	Label       string    `db:"label" json:"label"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UsableAfter time.Time `db:"usable_after" json:"usable_after"` // end of cooldown
+}
+
+// WithdrawalSettings represents user's withdrawal settings
+type WithdrawalSettings struct {
+	UserID string `db:"user_id" json:"user_id"`
+	// WhitelistOnly allows withdrawals only to address book entries past cooldown
+	WhitelistOnly bool `db:"whitelist_only" json:"whitelist_only"`
+	// WhitelistOnlyUntil is when turning whitelist-only off takes effect, it's enforced until then
+	WhitelistOnlyUntil *time.Time `db:"whitelist_only_until" json:"whitelist_only_until,omitempty"`
+	UpdatedAt          *time.Time `db:"updated_at" json:"updated_at,omitempty"`
+}
+
+// MerchantFeeSettings represents merchant's fee payer policy
+type MerchantFeeSettings struct {
+	MerchantID string     `db:"merchant_id" json:"merchant_id"`
+	FeeMode    FeeMode    `db:"fee_mode" json:"fee_mode"`
+	UpdatedAt  *time.Time `db:"updated_at" json:"updated_at,omitempty"`
+}
+
+// WithdrawalQuote is fee estimate for withdrawal, amounts are in base units
+type WithdrawalQuote struct {
+	Chain      Chain              `json:"chain"`
+	Asset      string             `json:"asset"`
+	MerchantID string             `json:"merchant_id,omitempty"`
+	FeeMode    FeeMode            `json:"fee_mode"`
+	Priority   WithdrawalPriority `json:"priority"`
+	Amount     string             `json:"amount"`
+	GasPrice   string             `json:"gas_price"`
+	GasLimit   uint64             `json:"gas_limit"`
+	NetworkFee string             `json:"network_fee"`
+	ServiceFee string             `json:"service_fee"`
+	// ReceiveAmount is sent to recipient, TotalAmount is charged to merchant
+	ReceiveAmount string `json:"receive_amount"`
+	TotalAmount   string `json:"total_amount"`
+}
+
+// WithdrawalLimit caps sum of withdrawals of chain asset sent within rolling window, or not sent yet.
+// Limits are per chain asset only, there is no total across chains.
+type WithdrawalLimit struct {
+	ID    int64  `db:"id" json:"id"`
+	Chain Chain  `db:"chain" json:"chain"`
+	Asset string `db:"asset" json:"asset"`
+	// UserID is "" for all withdrawals of chain asset together, "*" for every user separately, otherwise single user
+	UserID        string    `db:"user_id" json:"user_id"`
+	WindowSeconds int64     `db:"window_seconds" json:"window_seconds"`
+	MaxAmount     string    `db:"max_amount" json:"max_amount"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+
+	Usage string `db:"-" json:"usage,omitempty"` // current usage, filled for admin view
 }
 
 // HotWallet represents hot wallet for a chain
 type HotWallet struct {
-	ID            int64     `db:"id" json:"id"`
-	Chain         Chain     `db:"chain" json:"chain"`
-	Address       string    `db:"address" json:"address"`
-	EncryptedKey  string    `db:"encrypted_key" json:"-"` // не возвращаем в API
-	Balance       string    `db:"balance" json:"balance"`
-	LastCheckedAt time.Time `db:"last_checked_at" json:"last_checked_at"`
+	ID            int64           `db:"id" json:"id"`
+	Chain         Chain           `db:"chain" json:"chain"`
+	Address       string          `db:"address" json:"address"`
+	EncryptedKey  string          `db:"encrypted_key" json:"-"` // не возвращаем в API
+	Balance       string          `db:"balance" json:"balance"`
+	Status        HotWalletStatus `db:"status" json:"status"`
+	LastCheckedAt time.Time       `db:"last_checked_at" json:"last_checked_at"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+	RetiredAt     *time.Time      `db:"retired_at" json:"retired_at"`
+}
+
+// WalletTransfer represents transfer between hot and cold wallets
+type WalletTransfer struct {
+	ID             int64                   `db:"id" json:"id"`
+	Chain          Chain                   `db:"chain" json:"chain"`
+	Direction      WalletTransferDirection `db:"direction" json:"direction"`
+	FromAddress    string                  `db:"from_address" json:"from_address"`
+	ToAddress      string                  `db:"to_address" json:"to_address"`
+	Amount         string                  `db:"amount" json:"amount"`
+	TxHash         string                  `db:"tx_hash" json:"tx_hash"`
+	Status         WalletTransferStatus    `db:"status" json:"status"`
+	UnsignedBundle string                  `db:"unsigned_bundle" json:"-"` // last bundle exported for offline signing
+	RawTx          string                  `db:"raw_tx" json:"-"`          // signed tx, saved before broadcast
+	CreatedAt      time.Time               `db:"created_at" json:"created_at"`
+	SentAt         *time.Time              `db:"sent_at" json:"sent_at"`
+	ConfirmedAt    *time.Time              `db:"confirmed_at" json:"confirmed_at"`
 }
 
 // Transaction represents blockchain transaction
@@ -91,3 +374,20 @@ type Transaction struct {
 	Confirmations int       `db:"confirmations" json:"confirmations"`
 	CreatedAt     time.Time `db:"created_at" json:"created_at"`
 }
+
+// RescanJob represents admin requested reprocessing of block range
+type RescanJob struct {
+	ID        int64           `db:"id" json:"id"`
+	Chain     Chain           `db:"chain" json:"chain"`
+	FromBlock int64           `db:"from_block" json:"from_block"`
+	ToBlock   int64           `db:"to_block" json:"to_block"`
+	NextBlock int64           `db:"next_block" json:"next_block"` // first block not processed yet
+	Status    RescanJobStatus `db:"status" json:"status"`
+	Error     string          `db:"error" json:"error,omitempty"`
+	// FailedBlocks couldn't be processed, job went on without them
+	FailedBlocks []int64    `db:"failed_blocks" json:"failed_blocks,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+	StartedAt    *time.Time `db:"started_at" json:"started_at,omitempty"`
+	FinishedAt   *time.Time `db:"finished_at" json:"finished_at,omitempty"`
+}
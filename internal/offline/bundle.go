@@ -0,0 +1,104 @@
+package offline
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+)
+
+// BundleVersion is bumped when bundle format changes
+const BundleVersion = 1
+
+// Bundle is unsigned transaction exported for air-gapped signing
+type Bundle struct {
+	Version     int                          `json:"version"`
+	TransferID  int64                        `json:"transfer_id"`
+	Chain       string                       `json:"chain"`
+	Summary     string                       `json:"summary"`
+	Transaction adapters.UnsignedTransaction `json:"transaction"`
+	CreatedAt   time.Time                    `json:"created_at"`
+}
+
+// SignedBundle is bundle with signed raw transaction, imported back into service
+type SignedBundle struct {
+	Bundle Bundle `json:"bundle"`
+	adapters.SignedTransaction
+}
+
+// NewBundle creates bundle with human readable summary
+func NewBundle(transferID int64, chain string, tx *adapters.UnsignedTransaction) *Bundle {
+	return &Bundle{
+		Version:     BundleVersion,
+		TransferID:  transferID,
+		Chain:       chain,
+		Summary:     Summarize(chain, tx),
+		Transaction: *tx,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// Sign signs bundle transaction with hex encoded private key
+func Sign(bundle *Bundle, privateKeyHex []byte) (*SignedBundle, error) {
+	if bundle.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+
+	signed, err := adapters.SignTransaction(&bundle.Transaction, privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedBundle{
+		Bundle:            *bundle,
+		SignedTransaction: *signed,
+	}, nil
+}
+
+// nativeSymbols is used in summaries only
+var nativeSymbols = map[string]string{
+	"ethereum": "ETH",
+	"polygon":  "POL",
+	"bsc":      "BNB",
+	"arbitrum": "ETH",
+	"optimism": "ETH",
+}
+
+// Summarize describes transaction for the person who signs it
+func Summarize(chain string, tx *adapters.UnsignedTransaction) string {
+	value, _ := new(big.Int).SetString(tx.Value, 10)
+	gasPrice, _ := new(big.Int).SetString(tx.GasPrice, 10)
+	maxFee := new(big.Int)
+	if gasPrice != nil {
+		maxFee.Mul(gasPrice, new(big.Int).SetUint64(tx.Gas))
+	}
+
+	symbol := nativeSymbols[chain]
+	return fmt.Sprintf(
+		"Send %s %s from %s to %s on %s (chain id %s), nonce %d, gas %d at %s gwei, max fee %s %s",
+		FormatUnits(value, 18), symbol, tx.From, tx.To, chain, tx.ChainID, tx.Nonce, tx.Gas, FormatUnits(gasPrice, 9), FormatUnits(maxFee, 18), symbol,
+	)
+}
+
+// FormatUnits formats integer amount with given decimals, e.g. wei as ether
+func FormatUnits(amount *big.Int, decimals int) string {
+	if amount == nil {
+		return "?"
+	}
+
+	s := new(big.Int).Abs(amount).String()
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-decimals], strings.TrimRight(s[len(s)-decimals:], "0")
+
+	if amount.Sign() < 0 {
+		whole = "-" + whole
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
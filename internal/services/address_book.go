@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// ErrDestinationNotAllowed is returned for withdrawal of whitelist-only user to address
+// not in address book or still in cooldown
+var ErrDestinationNotAllowed = errors.New("destination is not whitelisted")
+
+// AddAddress adds destination to user's address book, it can be used by whitelist-only user after cooldown.
+// Adding known address only updates its label.
+func (s *WithdrawalService) AddAddress(ctx context.Context, userID string, chain models.Chain, address, label string) (*models.WithdrawalAddress, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("user id is required")
+	}
+	adapter, ok := s.adapters[chain]
+	if !ok {
+		return nil, fmt.Errorf("chain %s not supported", chain)
+	}
+	address, _, err := s.validateDestination(ctx, adapter, chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.WithdrawalAddress{
+		UserID:      userID,
+		Chain:       chain,
+		Address:     address,
+		Label:       label,
+		UsableAfter: time.Now().Add(s.policy.AddressCooldown),
+	}
+	if err := s.storage.CreateWithdrawalAddress(entry); err != nil {
+		return nil, fmt.Errorf("failed to save address: %w", err)
+	}
+	return entry, nil
+}
+
+// ListAddresses returns user's address book, "" chain for all chains
+func (s *WithdrawalService) ListAddresses(ctx context.Context, userID string, chain models.Chain) ([]*models.WithdrawalAddress, error) {
+	addresses, err := s.storage.ListWithdrawalAddresses(userID, chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses: %w", err)
+	}
+	return addresses, nil
+}
+
+func (s *WithdrawalService) DeleteAddress(ctx context.Context, userID string, id int64) error {
+	deleted, err := s.storage.DeleteWithdrawalAddress(userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete address: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("address %d not found", id)
+	}
+	return nil
+}
+
+func (s *WithdrawalService) GetSettings(ctx context.Context, userID string) (*models.WithdrawalSettings, error) {
+	settings, err := s.storage.GetWithdrawalSettings(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SetWhitelistOnly toggles whitelist-only mode of user. Turning it off takes effect after
+// address cooldown, so whoever takes over account can't lift whitelist and withdraw at once.
+func (s *WithdrawalService) SetWhitelistOnly(ctx context.Context, userID string, whitelistOnly bool) (*models.WithdrawalSettings, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("user id is required")
+	}
+	settings := &models.WithdrawalSettings{
+		UserID:        userID,
+		WhitelistOnly: whitelistOnly,
+	}
+	if err := s.storage.SetWithdrawalSettings(settings, s.policy.AddressCooldown); err != nil {
+		return nil, fmt.Errorf("failed to save withdrawal settings: %w", err)
+	}
+	return settings, nil
+}
+
+// checkDestination labels withdrawal from user's address book and rejects
+// destinations whitelist-only user can't use. It's checked on creation and again before sending.
+func (s *WithdrawalService) checkDestination(withdrawal *models.Withdrawal) error {
+	if withdrawal.UserID == "" {
+		// Whitelist is per user, merchant with whitelist-only users can't let withdrawals skip it
+		if s.policy.WhitelistMerchants[withdrawal.MerchantID] {
+			return fmt.Errorf("%w: user id is required for merchant %s", ErrDestinationNotAllowed, withdrawal.MerchantID)
+		}
+		return nil
+	}
+
+	entry, err := s.storage.GetWithdrawalAddress(withdrawal.UserID, withdrawal.Chain, withdrawal.ToAddress)
+	if err != nil {
+		return fmt.Errorf("failed to get address book entry: %w", err)
+	}
+	if entry != nil {
+		withdrawal.ToLabel = entry.Label
+	}
+
+	settings, err := s.storage.GetWithdrawalSettings(withdrawal.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get withdrawal settings: %w", err)
+	}
+	if !settings.WhitelistOnly && (settings.WhitelistOnlyUntil == nil || time.Now().After(*settings.WhitelistOnlyUntil)) {
+		return nil
+	}
+	if entry == nil {
+		return fmt.Errorf("%w: %s is not in address book", ErrDestinationNotAllowed, withdrawal.ToAddress)
+	}
+	if time.Now().Before(entry.UsableAfter) {
+		return fmt.Errorf("%w: %s is in cooldown until %s", ErrDestinationNotAllowed, withdrawal.ToAddress, entry.UsableAfter.Format(time.RFC3339))
+	}
+	return nil
+}
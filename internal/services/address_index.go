@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/storage"
+)
+
+// AddressIndex keeps watched deposit addresses in memory, so deposit monitor
+// only queries DB for transactions to candidate addresses.
+// With bloom filter enabled it uses less memory at the cost of occasional false positives.
+type AddressIndex struct {
+	storage  storage.Storage
+	useBloom bool
+
+	// loadMu serializes loads, so only one load per chain collects pending adds
+	loadMu sync.Mutex
+
+	mu   sync.RWMutex
+	sets map[models.Chain]addressSet
+	// pending holds addresses added while chain is being loaded, they're merged into loaded set
+	pending map[models.Chain][]string
+}
+
+type addressSet interface {
+	add(address string)
+	mayContain(address string) bool
+}
+
+func NewAddressIndex(storage storage.Storage, useBloom bool) *AddressIndex {
+	return &AddressIndex{
+		storage:  storage,
+		useBloom: useBloom,
+		sets:     make(map[models.Chain]addressSet),
+		pending:  make(map[models.Chain][]string),
+	}
+}
+
+// Load (re)loads watched addresses of chain from DB.
+// Addresses added while DB is read may be missing from it, they're kept and merged in.
+func (i *AddressIndex) Load(chain models.Chain) error {
+	i.loadMu.Lock()
+	defer i.loadMu.Unlock()
+
+	i.mu.Lock()
+	i.pending[chain] = []string{}
+	i.mu.Unlock()
+
+	addresses, err := i.storage.GetWatchedAddresses(chain)
+	if err != nil {
+		i.mu.Lock()
+		delete(i.pending, chain)
+		i.mu.Unlock()
+		return fmt.Errorf("failed to get watched addresses: %w", err)
+	}
+
+	var set addressSet
+	if i.useBloom {
+		set = newBloomSet(len(addresses))
+	} else {
+		set = make(mapSet, len(addresses))
+	}
+	for _, address := range addresses {
+		set.add(normalizeAddress(address))
+	}
+
+	i.mu.Lock()
+	for _, address := range i.pending[chain] {
+		set.add(address)
+	}
+	delete(i.pending, chain)
+	i.sets[chain] = set
+	i.mu.Unlock()
+	return nil
+}
+
+// LoadAll reloads all chains already in index, errors are logged
+func (i *AddressIndex) LoadAll() {
+	i.mu.RLock()
+	chains := make([]models.Chain, 0, len(i.sets))
+	for chain := range i.sets {
+		chains = append(chains, chain)
+	}
+	i.mu.RUnlock()
+
+	for _, chain := range chains {
+		if err := i.Load(chain); err != nil {
+			fmt.Printf("Error reloading address index for %s: %v\n", chain, err)
+		}
+	}
+}
+
+// Add adds new deposit address
+func (i *AddressIndex) Add(chain models.Chain, address string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	set, ok := i.sets[chain]
+	if !ok {
+		if i.useBloom {
+			set = newBloomSet(0)
+		} else {
+			set = make(mapSet)
+		}
+		i.sets[chain] = set
+	}
+	address = normalizeAddress(address)
+	set.add(address)
+	if pending, ok := i.pending[chain]; ok {
+		i.pending[chain] = append(pending, address)
+	}
+}
+
+// MayContain reports whether address may be watched deposit address.
+// False means it's definitely not ours.
+func (i *AddressIndex) MayContain(chain models.Chain, address string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	set, ok := i.sets[chain]
+	if !ok {
+		return false
+	}
+	return set.mayContain(normalizeAddress(address))
+}
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(address)
+}
+
+type mapSet map[string]struct{}
+
+func (s mapSet) add(address string) {
+	s[address] = struct{}{}
+}
+
+func (s mapSet) mayContain(address string) bool {
+	_, ok := s[address]
+	return ok
+}
+
+// bloomSet is bloom filter sized for ~1% false positives.
+// It's rebuilt on Load, so growth past capacity between reloads only raises false positive rate.
+type bloomSet struct {
+	bits   []uint64
+	hashes uint64
+}
+
+const (
+	bloomBitsPerAddress = 10
+	bloomHashes         = 7
+	bloomMinCapacity    = 1024
+)
+
+func newBloomSet(n int) *bloomSet {
+	// Leave room for addresses created until next reload
+	capacity := 2 * n
+	if capacity < bloomMinCapacity {
+		capacity = bloomMinCapacity
+	}
+	words := (capacity*bloomBitsPerAddress + 63) / 64
+	return &bloomSet{
+		bits:   make([]uint64, words),
+		hashes: bloomHashes,
+	}
+}
+
+// positions uses double hashing: h1 + i*h2
+func (b *bloomSet) positions(address string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(address))
+	sum := h.Sum64()
+	return sum, sum>>32 | 1
+}
+
+func (b *bloomSet) add(address string) {
+	h1, h2 := b.positions(address)
+	size := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < b.hashes; i++ {
+		pos := (h1 + i*h2) % size
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloomSet) mayContain(address string) bool {
+	h1, h2 := b.positions(address)
+	size := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < b.hashes; i++ {
+		pos := (h1 + i*h2) % size
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/metrics"
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/storage"
+)
+
+// addressPoolBatch limits addresses generated per chain in one refill
+const addressPoolBatch = 100
+
+// AddressPool keeps pre-generated unassigned deposit addresses per chain,
+// so deposit address requests don't depend on adapter. Addresses are claimed
+// by WalletService through storage.
+type AddressPool struct {
+	storage  storage.Storage
+	adapters map[models.Chain]adapters.BlockchainAdapter
+	size     int
+}
+
+func NewAddressPool(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter, size int) *AddressPool {
+	for chain := range adapters {
+		metrics.AddressPoolTarget.WithLabelValues(string(chain)).Set(float64(size))
+	}
+
+	return &AddressPool{
+		storage:  storage,
+		adapters: adapters,
+		size:     size,
+	}
+}
+
+// Refill tops up pool of every chain to configured size
+func (p *AddressPool) Refill(ctx context.Context) {
+	for chain := range p.adapters {
+		if err := p.refillChain(ctx, chain); err != nil {
+			metrics.AddressPoolRefillErrors.WithLabelValues(string(chain)).Inc()
+			fmt.Printf("Error refilling address pool for %s: %v\n", chain, err)
+		}
+	}
+}
+
+func (p *AddressPool) refillChain(ctx context.Context, chain models.Chain) error {
+	adapter := p.adapters[chain]
+	available, err := p.storage.RefillPool(chain, p.size, addressPoolBatch, func() (string, error) {
+		address, err := adapter.GenerateAddress(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate address: %w", err)
+		}
+		return address, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refill pool: %w", err)
+	}
+	metrics.AddressPoolAvailable.WithLabelValues(string(chain)).Set(float64(available))
+	return nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// ApprovalPolicy decides which withdrawals wait for manual approval before sending
+type ApprovalPolicy struct {
+	// Thresholds - withdrawals of at least this amount (wei) need approval, chains without threshold don't
+	Thresholds map[models.Chain]*big.Int
+	// Destinations and Users always need approval, addresses are lowercase
+	Destinations map[string]bool
+	Users        map[string]bool
+	// RequiredApprovals is number of distinct approvers (2 for four-eyes)
+	RequiredApprovals int
+}
+
+// NewApprovalPolicy parses policy, thresholds are decimal wei strings, empty threshold disables amount rule
+func NewApprovalPolicy(thresholds map[models.Chain]string, destinations, users []string, requiredApprovals int) (*ApprovalPolicy, error) {
+	if requiredApprovals < 1 {
+		return nil, fmt.Errorf("required approvals must be at least 1, got %d", requiredApprovals)
+	}
+
+	policy := &ApprovalPolicy{
+		Thresholds:        make(map[models.Chain]*big.Int),
+		Destinations:      make(map[string]bool),
+		Users:             make(map[string]bool),
+		RequiredApprovals: requiredApprovals,
+	}
+	for chain, threshold := range thresholds {
+		if threshold == "" {
+			continue
+		}
+		value, ok := new(big.Int).SetString(threshold, 10)
+		if !ok || value.Sign() < 0 {
+			return nil, fmt.Errorf("invalid approval threshold for %s: %q", chain, threshold)
+		}
+		policy.Thresholds[chain] = value
+	}
+	for _, address := range destinations {
+		policy.Destinations[strings.ToLower(address)] = true
+	}
+	for _, user := range users {
+		policy.Users[user] = true
+	}
+	return policy, nil
+}
+
+// match returns why withdrawal needs approval, "" if it doesn't
+func (p *ApprovalPolicy) match(withdrawal *models.Withdrawal, amount *big.Int) string {
+	if threshold, ok := p.Thresholds[withdrawal.Chain]; ok && amount.Cmp(threshold) >= 0 {
+		return fmt.Sprintf("amount is at or above %s", threshold)
+	}
+	if p.Destinations[strings.ToLower(withdrawal.ToAddress)] {
+		return "destination requires approval"
+	}
+	if withdrawal.UserID != "" && p.Users[withdrawal.UserID] {
+		return "user requires approval"
+	}
+	return ""
+}
+
+// ListWithdrawals returns latest withdrawals with status ("" for any), e.g. approval queue
+func (s *WithdrawalService) ListWithdrawals(ctx context.Context, status models.WithdrawalStatus) ([]*models.Withdrawal, error) {
+	withdrawals, err := s.storage.ListWithdrawals(status, 100)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list withdrawals: %w", err)
+	}
+	return withdrawals, nil
+}
+
+// ApproveWithdrawal records approval, withdrawal is released for sending once
+// it has required number of distinct approvers
+func (s *WithdrawalService) ApproveWithdrawal(ctx context.Context, id int64, approver string) (*models.Withdrawal, error) {
+	return s.decide(ctx, &models.WithdrawalApproval{
+		WithdrawalID: id,
+		Approver:     approver,
+		Decision:     models.ApprovalDecisionApproved,
+	})
+}
+
+// RejectWithdrawal rejects withdrawal awaiting approval, it's never sent
+func (s *WithdrawalService) RejectWithdrawal(ctx context.Context, id int64, approver, reason string) (*models.Withdrawal, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("rejection reason is required")
+	}
+	return s.decide(ctx, &models.WithdrawalApproval{
+		WithdrawalID: id,
+		Approver:     approver,
+		Decision:     models.ApprovalDecisionRejected,
+		Reason:       reason,
+	})
+}
+
+func (s *WithdrawalService) decide(ctx context.Context, approval *models.WithdrawalApproval) (*models.Withdrawal, error) {
+	if approval.Approver == "" {
+		return nil, fmt.Errorf("approver is required")
+	}
+
+	withdrawal, err := s.storage.DecideWithdrawal(approval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save decision: %w", err)
+	}
+	if withdrawal == nil {
+		return nil, fmt.Errorf("withdrawal %d not found", approval.WithdrawalID)
+	}
+
+	switch {
+	case approval.Decision == models.ApprovalDecisionRejected:
+		s.addEvent(withdrawal, models.WithdrawalEventRejected, withdrawal.FailureReason)
+		// TODO: Send webhook/event about rejected withdrawal
+		fmt.Printf("Withdrawal rejected: chain=%s, order_id=%s, approver=%s, reason=%s\n", withdrawal.Chain, withdrawal.OrderID, approval.Approver, approval.Reason)
+	case withdrawal.Status == models.WithdrawalStatusPending:
+		s.addEvent(withdrawal, models.WithdrawalEventApproved, "approved by "+approval.Approver)
+		fmt.Printf("Withdrawal approved: chain=%s, order_id=%s, approver=%s\n", withdrawal.Chain, withdrawal.OrderID, approval.Approver)
+	default:
+		s.addEvent(withdrawal, models.WithdrawalEventApproved, "approved by "+approval.Approver+", waiting for more approvals")
+	}
+
+	return s.GetWithdrawal(ctx, withdrawal.ID)
+}
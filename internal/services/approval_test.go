@@ -0,0 +1,48 @@
+package services
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+func TestApprovalPolicyMatch(t *testing.T) {
+	policy, err := NewApprovalPolicy(
+		map[models.Chain]string{models.ChainEthereum: "1000", models.ChainPolygon: ""},
+		[]string{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		[]string{"vip"},
+		2,
+	)
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		chain   models.Chain
+		to      string
+		userID  string
+		amount  int64
+		matched bool
+	}{
+		{name: "below threshold", chain: models.ChainEthereum, to: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", amount: 999},
+		{name: "at threshold", chain: models.ChainEthereum, to: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", amount: 1000, matched: true},
+		{name: "above threshold", chain: models.ChainEthereum, to: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", amount: 5000, matched: true},
+		{name: "chain without threshold", chain: models.ChainPolygon, to: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", amount: 5000},
+		{name: "destination", chain: models.ChainPolygon, to: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", amount: 1, matched: true},
+		{name: "destination lowercase", chain: models.ChainPolygon, to: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", amount: 1, matched: true},
+		{name: "user", chain: models.ChainPolygon, to: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", userID: "vip", amount: 1, matched: true},
+		{name: "other user", chain: models.ChainPolygon, to: "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", userID: "alice", amount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withdrawal := &models.Withdrawal{Chain: tt.chain, ToAddress: tt.to, UserID: tt.userID}
+			reason := policy.match(withdrawal, big.NewInt(tt.amount))
+			if (reason != "") != tt.matched {
+				t.Fatalf("match = %q, want matched %v", reason, tt.matched)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"context"
 	"fmt"
+	"math/big"
+	"slices"
 	"time"
 
 	"github.com/dechat/exchange-service/internal/adapters"
@@ -11,53 +13,103 @@ import (
 )
 
 type DepositMonitor struct {
-	storage  storage.Storage
-	adapters map[models.Chain]adapters.BlockchainAdapter
-	configs  map[models.Chain]ChainMonitorConfig
+	storage      storage.Storage
+	adapters     map[models.Chain]adapters.BlockchainAdapter
+	configs      map[models.Chain]ChainMonitorConfig
+	toleranceBPS int
+	index        *AddressIndex
 }
 
 type ChainMonitorConfig struct {
+	// Confirmation decides when deposit block is final enough to credit
+	Confirmation ConfirmationPolicy
+	// MinConfirmations is used with ConfirmationBlocks policy
 	MinConfirmations int
 	PollInterval     time.Duration
 }
 
-func NewDepositMonitor(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter) *DepositMonitor {
-	configs := make(map[models.Chain]ChainMonitorConfig)
-	// Default configs
+// ConfirmationPolicy defines which blocks are considered confirmed
+type ConfirmationPolicy string
+
+const (
+	// ConfirmationBlocks - block has at least MinConfirmations blocks on top of it
+	ConfirmationBlocks ConfirmationPolicy = "blocks"
+	// ConfirmationSafe - block is at or below node's "safe" block
+	ConfirmationSafe ConfirmationPolicy = "safe"
+	// ConfirmationFinalized - block is at or below node's "finalized" block
+	ConfirmationFinalized ConfirmationPolicy = "finalized"
+)
+
+// NewDepositMonitor creates monitor, chains missing in configs use 1 block confirmation
+func NewDepositMonitor(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter, configs map[models.Chain]ChainMonitorConfig, toleranceBPS int, index *AddressIndex) *DepositMonitor {
+	chainConfigs := make(map[models.Chain]ChainMonitorConfig)
 	for chain := range adapters {
-		configs[chain] = ChainMonitorConfig{
-			MinConfirmations: 1,
-			PollInterval:     5 * time.Second,
+		config, ok := configs[chain]
+		if !ok {
+			// Default config
+			config = ChainMonitorConfig{
+				Confirmation:     ConfirmationBlocks,
+				MinConfirmations: 1,
+			}
 		}
+		if config.Confirmation == "" {
+			config.Confirmation = ConfirmationBlocks
+		}
+		if config.PollInterval == 0 {
+			config.PollInterval = 5 * time.Second
+		}
+		chainConfigs[chain] = config
 	}
 
 	return &DepositMonitor{
-		storage:  storage,
-		adapters: adapters,
-		configs:  configs,
+		storage:      storage,
+		adapters:     adapters,
+		configs:      chainConfigs,
+		toleranceBPS: toleranceBPS,
+		index:        index,
 	}
 }
 
 // Start starts monitoring deposits for all chains
 func (m *DepositMonitor) Start(ctx context.Context) error {
+	for chain := range m.adapters {
+		if err := m.index.Load(chain); err != nil {
+			return fmt.Errorf("failed to load address index for %s: %w", chain, err)
+		}
+	}
 	for chain := range m.adapters {
 		go m.monitorChain(ctx, chain)
 	}
 	return nil
 }
 
+// monitorChain processes new blocks of chain. Last processed block is saved, so after restart
+// monitor resumes where it stopped. Block that failed is retried on next tick, later blocks wait for it.
 func (m *DepositMonitor) monitorChain(ctx context.Context, chain models.Chain) {
 	config := m.configs[chain]
 	ticker := time.NewTicker(config.PollInterval)
 	defer ticker.Stop()
 
-	var lastBlock int64 = 0
+	lastBlock, err := m.storage.GetMonitorProgress(chain)
+	if err != nil {
+		// Not fatal, progress is loaded again on next tick
+		fmt.Printf("Error getting monitor progress for %s: %v\n", chain, err)
+		lastBlock = -1
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			if lastBlock < 0 {
+				if lastBlock, err = m.storage.GetMonitorProgress(chain); err != nil {
+					fmt.Printf("Error getting monitor progress for %s: %v\n", chain, err)
+					lastBlock = -1
+					continue
+				}
+			}
+
 			// Get latest block
 			adapter := m.adapters[chain]
 			latestBlock, err := adapter.GetLatestBlock(ctx)
@@ -66,19 +118,45 @@ func (m *DepositMonitor) monitorChain(ctx context.Context, chain models.Chain) {
 				continue
 			}
 
-			// Process blocks from lastBlock+1 to latestBlock
-			for blockNum := lastBlock + 1; blockNum <= latestBlock; blockNum++ {
-				if err := m.processBlock(ctx, chain, blockNum, config.MinConfirmations); err != nil {
-					fmt.Printf("Error processing block %d for %s: %v\n", blockNum, chain, err)
+			if lastBlock == 0 {
+				// Chain was never monitored, start from chain head, history is reprocessed with rescan jobs
+				if err := m.storage.SaveMonitorProgress(chain, latestBlock-1); err != nil {
+					fmt.Printf("Error saving monitor progress for %s: %v\n", chain, err)
+					continue
+				}
+				lastBlock = latestBlock - 1
+			}
+
+			// Process blocks from lastBlock+1 to latestBlock, stop at first failure
+			processed := lastBlock
+			for blockNum := lastBlock + 1; blockNum <= latestBlock && ctx.Err() == nil; blockNum++ {
+				if err := m.processBlock(ctx, chain, blockNum); err != nil {
+					fmt.Printf("Error processing block %d for %s, will retry: %v\n", blockNum, chain, err)
+					break
+				}
+				processed = blockNum
+			}
+
+			if processed > lastBlock {
+				if err := m.storage.SaveMonitorProgress(chain, processed); err != nil {
+					fmt.Printf("Error saving monitor progress for %s: %v\n", chain, err)
 				}
 			}
+			lastBlock = processed
 
-			lastBlock = latestBlock
+			confirmedHead, err := confirmedHead(ctx, adapter, config, latestBlock)
+			if err != nil {
+				fmt.Printf("Error getting confirmed block for %s: %v\n", chain, err)
+				continue
+			}
+			if err := m.updateConfirmations(ctx, chain, latestBlock, confirmedHead); err != nil {
+				fmt.Printf("Error updating confirmations for %s: %v\n", chain, err)
+			}
 		}
 	}
 }
 
-func (m *DepositMonitor) processBlock(ctx context.Context, chain models.Chain, blockNumber int64, minConfirmations int) error {
+func (m *DepositMonitor) processBlock(ctx context.Context, chain models.Chain, blockNumber int64) error {
 	adapter := m.adapters[chain]
 	transactions, err := adapter.GetBlockTransactions(ctx, blockNumber)
 	if err != nil {
@@ -86,7 +164,10 @@ func (m *DepositMonitor) processBlock(ctx context.Context, chain models.Chain, b
 	}
 
 	for _, tx := range transactions {
-		// Check if this is a deposit to one of our addresses
+		// Check if this is a deposit to one of our addresses, DB is only queried for candidates
+		if !m.index.MayContain(chain, tx.To) {
+			continue
+		}
 		deposit, err := m.storage.GetDepositByAddress(chain, tx.To)
 		if err != nil {
 			return fmt.Errorf("failed to get deposit: %w", err)
@@ -95,38 +176,274 @@ func (m *DepositMonitor) processBlock(ctx context.Context, chain models.Chain, b
 		if deposit == nil {
 			continue // Not our address
 		}
+		if err := m.recordTransfer(chain, deposit, tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rescanBlock processes block like processBlock, but finds deposits regardless of watch window,
+// so old blocks credit deposits whose addresses aren't watched anymore
+func (m *DepositMonitor) rescanBlock(ctx context.Context, chain models.Chain, blockNumber int64) error {
+	adapter := m.adapters[chain]
+	transactions, err := adapter.GetBlockTransactions(ctx, blockNumber)
+	if err != nil {
+		return fmt.Errorf("failed to get block transactions: %w", err)
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	addresses := make([]string, 0, len(transactions))
+	for _, tx := range transactions {
+		addresses = append(addresses, tx.To)
+	}
+	deposits, err := m.storage.GetDepositsByAddresses(chain, addresses)
+	if err != nil {
+		return fmt.Errorf("failed to get deposits: %w", err)
+	}
+
+	for _, tx := range transactions {
+		deposit, ok := deposits[tx.To]
+		if !ok {
+			continue // Not our address
+		}
+		if err := m.recordTransfer(chain, deposit, tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordTransfer saves transfer to deposit address and refreshes deposit
+func (m *DepositMonitor) recordTransfer(chain models.Chain, deposit *models.Deposit, tx *adapters.Transaction) error {
+	// Every transfer is recorded, already known ones are skipped
+	transfer := &models.DepositTransfer{
+		DepositID:   deposit.ID,
+		Chain:       chain,
+		TxHash:      tx.Hash,
+		LogIndex:    tx.LogIndex,
+		FromAddress: tx.From,
+		Asset:       tx.Asset,
+		Amount:      tx.Amount.String(),
+		BlockNumber: tx.BlockNum,
+		BlockHash:   tx.BlockHash,
+		Late:        isLate(deposit, tx.BlockTime),
+		// Static address accepts any asset, each transfer is credited separately
+		WrongAsset: deposit.Mode != models.DepositModeStatic && tx.Asset != deposit.Asset,
+	}
+	created, err := m.storage.CreateDepositTransfer(transfer)
+	if err != nil {
+		return fmt.Errorf("failed to save deposit transfer: %w", err)
+	}
+	if !created {
+		return nil
+	}
+
+	if transfer.WrongAsset {
+		// Deposit doesn't change, transfer is listed for ops refund
+		fmt.Printf("Warning: wrong asset %s for deposit %d (expected %s), amount=%s, tx_hash=%s\n", tx.Asset, deposit.ID, deposit.Asset, transfer.Amount, tx.Hash)
+		return nil
+	}
 
-		// Check if already processed
-		if deposit.TxHash == tx.Hash {
+	fmt.Printf("Deposit transfer detected: chain=%s, order_id=%s, amount=%s, tx_hash=%s\n", chain, deposit.OrderID, transfer.Amount, tx.Hash)
+	return m.refreshDeposit(deposit)
+}
+
+// confirmedHead returns highest block considered confirmed by chain policy
+func confirmedHead(ctx context.Context, adapter adapters.BlockchainAdapter, config ChainMonitorConfig, latestBlock int64) (int64, error) {
+	switch config.Confirmation {
+	case ConfirmationBlocks:
+		return latestBlock - int64(config.MinConfirmations), nil
+	case ConfirmationSafe:
+		return adapter.GetTaggedBlock(ctx, adapters.BlockTagSafe)
+	case ConfirmationFinalized:
+		return adapter.GetTaggedBlock(ctx, adapters.BlockTagFinalized)
+	}
+	return 0, fmt.Errorf("unknown confirmation policy: %s", config.Confirmation)
+}
+
+// updateConfirmations updates confirmations of unconfirmed transfers. Transfers in blocks at or below
+// confirmedHead are confirmed if their block is still canonical, otherwise they are dropped and
+// canonical block at that height is processed again.
+func (m *DepositMonitor) updateConfirmations(ctx context.Context, chain models.Chain, latestBlock, confirmedHead int64) error {
+	adapter := m.adapters[chain]
+	transfers, err := m.storage.GetUnconfirmedDepositTransfers(chain)
+	if err != nil {
+		return fmt.Errorf("failed to get unconfirmed transfers: %w", err)
+	}
+
+	// Deposit id -> transfers confirmed in this run
+	changed := make(map[int64][]*models.DepositTransfer)
+	// Block number -> canonical block hash
+	canonical := make(map[int64]string)
+	var reorged []int64
+	for _, transfer := range transfers {
+		confirmations := int(latestBlock - transfer.BlockNumber)
+		if confirmations < 0 {
+			confirmations = 0
+		}
+		confirmed := transfer.BlockNumber <= confirmedHead
+		if confirmations == transfer.Confirmations && !confirmed {
 			continue
 		}
 
-		// Get transaction status
-		status, err := adapter.GetTransactionStatus(ctx, tx.Hash)
+		if confirmed {
+			hash, ok := canonical[transfer.BlockNumber]
+			if !ok {
+				hash, err = adapter.GetBlockHash(ctx, transfer.BlockNumber)
+				if err != nil {
+					return fmt.Errorf("failed to get block hash: %w", err)
+				}
+				canonical[transfer.BlockNumber] = hash
+				if hash != transfer.BlockHash {
+					reorged = append(reorged, transfer.BlockNumber)
+				}
+			}
+			if hash != transfer.BlockHash {
+				// Block was reorged out, transfer is recorded again if tx is in canonical chain
+				if err := m.storage.DeleteDepositTransfer(transfer.ID); err != nil {
+					return fmt.Errorf("failed to drop deposit transfer: %w", err)
+				}
+				fmt.Printf("Warning: deposit transfer dropped, block %d was reorged out: chain=%s, tx_hash=%s\n", transfer.BlockNumber, chain, transfer.TxHash)
+				if _, ok := changed[transfer.DepositID]; !ok {
+					changed[transfer.DepositID] = nil
+				}
+				continue
+			}
+		}
+
+		transfer.Confirmations = confirmations
+		if confirmed {
+			transfer.Confirmed = true
+			now := time.Now()
+			transfer.ConfirmedAt = &now
+		}
+		if err := m.storage.UpdateDepositTransfer(transfer); err != nil {
+			return fmt.Errorf("failed to update deposit transfer: %w", err)
+		}
+		if transfer.Confirmed {
+			changed[transfer.DepositID] = append(changed[transfer.DepositID], transfer)
+		} else if _, ok := changed[transfer.DepositID]; !ok {
+			changed[transfer.DepositID] = nil
+		}
+	}
+
+	// Live monitor is past these heights already
+	for _, blockNumber := range reorged {
+		if err := m.rescanBlock(ctx, chain, blockNumber); err != nil {
+			return fmt.Errorf("failed to process block %d again: %w", blockNumber, err)
+		}
+	}
+
+	for depositID, confirmed := range changed {
+		deposit, err := m.storage.GetDepositByID(depositID)
 		if err != nil {
-			return fmt.Errorf("failed to get tx status: %w", err)
+			return fmt.Errorf("failed to get deposit: %w", err)
+		}
+		if deposit == nil {
+			continue
+		}
+		if err := m.refreshDeposit(deposit); err != nil {
+			return err
 		}
 
-		// Update deposit
-		deposit.TxHash = tx.Hash
-		deposit.ReceivedAmount = tx.Amount.String()
-		deposit.BlockNumber = status.BlockNumber
-		deposit.Confirmations = status.Confirmations
+		if deposit.Mode == models.DepositModeStatic {
+			for _, transfer := range confirmed {
+				// TODO: Send webhook/event about user credit
+				fmt.Printf("User credit confirmed: chain=%s, user_id=%s, asset=%s, amount=%s, tx_hash=%s\n", chain, deposit.UserID, transfer.Asset, transfer.Amount, transfer.TxHash)
+			}
+		}
+	}
 
-		if status.Confirmations >= minConfirmations {
-			deposit.Status = models.DepositStatusConfirmed
-			now := time.Now()
-			deposit.ConfirmedAt = &now
+	return nil
+}
+
+// refreshDeposit derives deposit totals and status from its transfers.
+// Only confirmed transfers count towards received amount, wrong asset ones don't count at all.
+func (m *DepositMonitor) refreshDeposit(deposit *models.Deposit) error {
+	transfers, err := m.storage.GetDepositTransfers(deposit.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get deposit transfers: %w", err)
+	}
+
+	expected, ok := parseAmount(deposit.ExpectedAmount)
+	if !ok {
+		return fmt.Errorf("invalid expected amount for deposit %d: %s", deposit.ID, deposit.ExpectedAmount)
+	}
+
+	// Wrong asset transfers are only kept for refund
+	transfers = slices.DeleteFunc(transfers, func(t *models.DepositTransfer) bool { return t.WrongAsset })
+
+	received := new(big.Int)
+	confirmedCount, onTimeCount := 0, 0
+	for _, transfer := range transfers {
+		if !transfer.Late {
+			onTimeCount++
 		}
 
-		if err := m.storage.UpdateDeposit(deposit); err != nil {
-			return fmt.Errorf("failed to update deposit: %w", err)
+		// Latest transfer is shown on deposit itself
+		deposit.TxHash = transfer.TxHash
+		deposit.BlockNumber = transfer.BlockNumber
+		deposit.Confirmations = transfer.Confirmations
+
+		if !transfer.Confirmed {
+			continue
+		}
+		amount, ok := parseAmount(transfer.Amount)
+		if !ok {
+			return fmt.Errorf("invalid amount for deposit transfer %d: %s", transfer.ID, transfer.Amount)
+		}
+		received.Add(received, amount)
+		confirmedCount++
+	}
+
+	previous := deposit.Status
+	// Transfers to static address are separate credits in any asset,
+	// it has no total or payment status of its own
+	if deposit.Mode != models.DepositModeStatic {
+		deposit.ReceivedAmount = received.String()
+		switch {
+		case len(transfers) > 0 && onTimeCount == 0:
+			// Nothing arrived before expiry, ops refund or honor it
+			deposit.Status = models.DepositStatusLate
+		case confirmedCount > 0:
+			deposit.Status = paymentStatus(expected, received, m.toleranceBPS)
+		case len(transfers) > 0 && deposit.Status == models.DepositStatusPending:
+			// In block but not confirmed yet (mempool watcher may have seen it before)
+			deposit.Status = models.DepositStatusDetected
+			deposit.DetectedTxHash = transfers[0].TxHash
+			now := time.Now()
+			deposit.DetectedAt = &now
 		}
+	}
+	if confirmedCount > 0 && deposit.ConfirmedAt == nil {
+		now := time.Now()
+		deposit.ConfirmedAt = &now
+	}
 
-		// TODO: Send webhook/event about deposit confirmation
-		fmt.Printf("Deposit confirmed: chain=%s, order_id=%s, amount=%s\n", chain, deposit.OrderID, deposit.ReceivedAmount)
+	if err := m.storage.UpdateDeposit(deposit); err != nil {
+		return fmt.Errorf("failed to update deposit: %w", err)
 	}
 
+	if deposit.Status != previous {
+		// TODO: Send webhook/event about deposit status change
+		fmt.Printf("Deposit updated: chain=%s, order_id=%s, amount=%s, status=%s\n", deposit.Chain, deposit.OrderID, deposit.ReceivedAmount, deposit.Status)
+	}
 	return nil
 }
 
+// isLate reports whether transfer mined at blockTime arrived after deposit expired.
+// Block time is used, so transfers processed late (monitor lag, rescan) aren't marked late.
+func isLate(deposit *models.Deposit, blockTime time.Time) bool {
+	if deposit.ExpiresAt == nil {
+		return false
+	}
+	if blockTime.IsZero() {
+		blockTime = time.Now()
+	}
+	return blockTime.After(*deposit.ExpiresAt)
+}
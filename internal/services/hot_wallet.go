@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/keystore"
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/storage"
+)
+
+// HotWalletService manages hot wallet keys. Plaintext keys never leave this service.
+type HotWalletService struct {
+	storage  storage.Storage
+	adapters map[models.Chain]adapters.BlockchainAdapter
+	keys     *keystore.Keystore
+}
+
+func NewHotWalletService(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter, keys *keystore.Keystore) *HotWalletService {
+	return &HotWalletService{
+		storage:  storage,
+		adapters: adapters,
+		keys:     keys,
+	}
+}
+
+// GenerateHotWallet generates new key and stores it as active wallet for chain
+func (s *HotWalletService) GenerateHotWallet(ctx context.Context, chain models.Chain) (*models.HotWallet, error) {
+	wallet, err := s.newGeneratedWallet(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.CreateHotWallet(wallet); err != nil {
+		return nil, fmt.Errorf("failed to save hot wallet: %w", err)
+	}
+	return wallet, nil
+}
+
+// ImportHotWallet stores existing hex encoded private key as active wallet for chain.
+// Caller owns key buffer and should wipe it.
+func (s *HotWalletService) ImportHotWallet(ctx context.Context, chain models.Chain, privateKeyHex []byte) (*models.HotWallet, error) {
+	wallet, err := s.newImportedWallet(chain, privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.CreateHotWallet(wallet); err != nil {
+		return nil, fmt.Errorf("failed to save hot wallet: %w", err)
+	}
+	return wallet, nil
+}
+
+// RotateHotWallet retires active wallet and replaces it with new one on same chain.
+// New key is generated if privateKeyHex is empty.
+func (s *HotWalletService) RotateHotWallet(ctx context.Context, id int64, privateKeyHex []byte) (*models.HotWallet, error) {
+	current, err := s.storage.GetHotWalletByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hot wallet: %w", err)
+	}
+	if current == nil || current.Status != models.HotWalletStatusActive {
+		return nil, fmt.Errorf("active hot wallet %d not found", id)
+	}
+
+	var wallet *models.HotWallet
+	if len(privateKeyHex) == 0 {
+		wallet, err = s.newGeneratedWallet(current.Chain)
+	} else {
+		wallet, err = s.newImportedWallet(current.Chain, privateKeyHex)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.RotateHotWallet(current.ID, wallet); err != nil {
+		return nil, fmt.Errorf("failed to rotate hot wallet: %w", err)
+	}
+
+	// TODO: sweep remaining balance from retired wallet
+	return wallet, nil
+}
+
+// RetireHotWallet marks wallet as retired, it won't be used for withdrawals anymore
+func (s *HotWalletService) RetireHotWallet(ctx context.Context, id int64) error {
+	if err := s.storage.RetireHotWallet(id); err != nil {
+		return fmt.Errorf("failed to retire hot wallet: %w", err)
+	}
+	return nil
+}
+
+// ListHotWallets returns wallets for chain (all chains if empty).
+// Balance is refreshed from chain when adapter is available, otherwise cached value is returned.
+func (s *HotWalletService) ListHotWallets(ctx context.Context, chain models.Chain) ([]*models.HotWallet, error) {
+	wallets, err := s.storage.ListHotWallets(chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hot wallets: %w", err)
+	}
+
+	for _, wallet := range wallets {
+		adapter, ok := s.adapters[wallet.Chain]
+		if !ok {
+			continue
+		}
+
+		balance, err := adapter.GetBalance(ctx, wallet.Address)
+		if err != nil {
+			fmt.Printf("Warning: failed to get balance for %s: %v\n", wallet.Address, err)
+			continue
+		}
+		wallet.Balance = balance.String()
+	}
+
+	return wallets, nil
+}
+
+func (s *HotWalletService) newGeneratedWallet(chain models.Chain) (*models.HotWallet, error) {
+	address, privateKey, err := adapters.GenerateEVMKey()
+	if err != nil {
+		return nil, err
+	}
+	defer keystore.Wipe(privateKey)
+
+	return s.newWallet(chain, address, privateKey)
+}
+
+func (s *HotWalletService) newImportedWallet(chain models.Chain, privateKeyHex []byte) (*models.HotWallet, error) {
+	address, err := adapters.EVMAddressFromKey(privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return s.newWallet(chain, address, privateKeyHex)
+}
+
+func (s *HotWalletService) newWallet(chain models.Chain, address string, privateKey []byte) (*models.HotWallet, error) {
+	encryptedKey, err := s.keys.Encrypt(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %w", err)
+	}
+
+	return &models.HotWallet{
+		Chain:        chain,
+		Address:      address,
+		EncryptedKey: encryptedKey,
+		Balance:      "0",
+		Status:       models.HotWalletStatusActive,
+	}, nil
+}
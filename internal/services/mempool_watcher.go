@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/storage"
+)
+
+// MempoolWatcher marks deposits as detected as soon as payment shows up in mempool.
+// Nothing is credited here, DepositMonitor records and confirms transfer once it's mined.
+type MempoolWatcher struct {
+	storage  storage.Storage
+	adapters map[models.Chain]adapters.BlockchainAdapter
+	index    *AddressIndex
+	modes    map[models.Chain]adapters.MempoolMode
+}
+
+func NewMempoolWatcher(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter, index *AddressIndex, modes map[models.Chain]adapters.MempoolMode) *MempoolWatcher {
+	return &MempoolWatcher{
+		storage:  storage,
+		adapters: adapters,
+		index:    index,
+		modes:    modes,
+	}
+}
+
+// Start starts watching mempool of chains with mempool mode set
+func (w *MempoolWatcher) Start(ctx context.Context) {
+	for chain, mode := range w.modes {
+		if mode == adapters.MempoolDisabled {
+			continue
+		}
+		if _, ok := w.adapters[chain]; !ok {
+			continue
+		}
+		go w.watchChain(ctx, chain, mode)
+	}
+}
+
+func (w *MempoolWatcher) watchChain(ctx context.Context, chain models.Chain, mode adapters.MempoolMode) {
+	adapter := w.adapters[chain]
+	for {
+		err := adapter.WatchPendingTransactions(ctx, mode, func(tx *adapters.Transaction) {
+			if err := w.handleTransaction(chain, tx); err != nil {
+				fmt.Printf("Error handling pending transaction %s on %s: %v\n", tx.Hash, chain, err)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Mempool watcher for %s stopped: %v, restarting\n", chain, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+func (w *MempoolWatcher) handleTransaction(chain models.Chain, tx *adapters.Transaction) error {
+	if !w.index.MayContain(chain, tx.To) {
+		return nil
+	}
+
+	deposit, err := w.storage.GetDepositByAddress(chain, tx.To)
+	if err != nil {
+		return fmt.Errorf("failed to get deposit: %w", err)
+	}
+	if deposit == nil {
+		return nil
+	}
+
+	if deposit.Mode == models.DepositModeStatic {
+		// TODO: Send webhook/event about detected user credit
+		fmt.Printf("User credit detected: chain=%s, user_id=%s, asset=%s, amount=%s, tx_hash=%s\n", chain, deposit.UserID, tx.Asset, tx.Amount, tx.Hash)
+		return nil
+	}
+	if tx.Asset != deposit.Asset {
+		return nil
+	}
+
+	detected, err := w.storage.MarkDepositDetected(deposit.ID, tx.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to mark deposit detected: %w", err)
+	}
+	if detected {
+		// TODO: Send webhook/event about detected payment
+		fmt.Printf("Deposit detected in mempool: chain=%s, order_id=%s, amount=%s, tx_hash=%s\n", chain, deposit.OrderID, tx.Amount, tx.Hash)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"slices"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/offline"
+	"github.com/dechat/exchange-service/internal/storage"
+)
+
+// OfflineSigningService exports cold wallet transfers for air-gapped signing
+// and broadcasts signed result
+type OfflineSigningService struct {
+	storage  storage.Storage
+	adapters map[models.Chain]adapters.BlockchainAdapter
+}
+
+func NewOfflineSigningService(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter) *OfflineSigningService {
+	return &OfflineSigningService{
+		storage:  storage,
+		adapters: adapters,
+	}
+}
+
+// ListOpenTransfers returns rebalancing transfers not settled yet
+func (s *OfflineSigningService) ListOpenTransfers(ctx context.Context, chain models.Chain) ([]*models.WalletTransfer, error) {
+	transfers, err := s.storage.GetOpenWalletTransfers(chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// ExportBundle builds unsigned transaction for requested cold wallet transfer.
+// Exporting again replaces previous bundle (e.g. when gas price changed),
+// bundles signed before that can't be imported anymore.
+func (s *OfflineSigningService) ExportBundle(ctx context.Context, transferID int64) (*offline.Bundle, error) {
+	transfer, err := s.getColdTransfer(transferID, models.WalletTransferStatusRequested, models.WalletTransferStatusExported)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, ok := s.adapters[transfer.Chain]
+	if !ok {
+		return nil, fmt.Errorf("chain %s not supported", transfer.Chain)
+	}
+
+	amount, ok := new(big.Int).SetString(transfer.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount: %s", transfer.Amount)
+	}
+
+	unsigned, err := adapter.BuildTransaction(ctx, transfer.FromAddress, transfer.ToAddress, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build transaction: %w", err)
+	}
+
+	bundle := offline.NewBundle(transfer.ID, string(transfer.Chain), unsigned)
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle: %w", err)
+	}
+
+	if err := s.storage.SaveTransferBundle(transfer.ID, string(data)); err != nil {
+		return nil, fmt.Errorf("failed to save bundle: %w", err)
+	}
+
+	return bundle, nil
+}
+
+// ImportSigned checks signed bundle against exported one, marks transfer sent and broadcasts it.
+// Transfer is marked sent only if it's still exported with the same bundle, so concurrent or
+// repeated imports of one bundle fail. Failed broadcast is retried by rebalance check of sent transfers.
+func (s *OfflineSigningService) ImportSigned(ctx context.Context, transferID int64, signed *offline.SignedBundle) (*models.WalletTransfer, error) {
+	transfer, err := s.getColdTransfer(transferID, models.WalletTransferStatusExported)
+	if err != nil {
+		return nil, err
+	}
+	bundle := transfer.UnsignedBundle
+
+	var exported offline.Bundle
+	if err := json.Unmarshal([]byte(bundle), &exported); err != nil {
+		return nil, fmt.Errorf("failed to decode exported bundle: %w", err)
+	}
+	if signed.Bundle.TransferID != transfer.ID || !reflect.DeepEqual(signed.Bundle.Transaction, exported.Transaction) {
+		return nil, fmt.Errorf("signed bundle doesn't match exported bundle")
+	}
+
+	adapter, ok := s.adapters[transfer.Chain]
+	if !ok {
+		return nil, fmt.Errorf("chain %s not supported", transfer.Chain)
+	}
+
+	// Raw tx is verified against exported transaction, not the one sent back to us
+	tx, err := adapters.VerifySignedTransaction(&exported.Transaction, signed.RawTx)
+	if err != nil {
+		return nil, fmt.Errorf("signed tx doesn't match: %w", err)
+	}
+
+	transfer.TxHash = tx.Hash().Hex()
+	transfer.RawTx = signed.RawTx
+	if err := s.storage.MarkTransferSent(transfer, bundle); err != nil {
+		return nil, fmt.Errorf("failed to update transfer: %w", err)
+	}
+
+	if _, err := adapter.SendRawTransaction(ctx, signed.RawTx); err != nil {
+		fmt.Printf("Warning: failed to broadcast offline signed transfer %d, will be rebroadcast: %v\n", transfer.ID, err)
+		return transfer, nil
+	}
+
+	fmt.Printf("Offline signed transfer sent: chain=%s, id=%d, tx_hash=%s\n", transfer.Chain, transfer.ID, transfer.TxHash)
+	return transfer, nil
+}
+
+// getColdTransfer returns cold wallet transfer in one of statuses
+func (s *OfflineSigningService) getColdTransfer(id int64, statuses ...models.WalletTransferStatus) (*models.WalletTransfer, error) {
+	transfer, err := s.storage.GetWalletTransfer(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+	if transfer == nil {
+		return nil, fmt.Errorf("transfer %d not found", id)
+	}
+	if transfer.Direction != models.WalletTransferColdToHot {
+		return nil, fmt.Errorf("transfer %d is not from cold wallet", id)
+	}
+	if !slices.Contains(statuses, transfer.Status) {
+		return nil, fmt.Errorf("%w: transfer %d is %s", storage.ErrTransferStateChanged, id, transfer.Status)
+	}
+	return transfer, nil
+}
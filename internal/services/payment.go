@@ -0,0 +1,41 @@
+package services
+
+import (
+	"math/big"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// paymentStatus compares received amount to expected one.
+// Difference within toleranceBPS (basis points of expected) counts as exact payment.
+// Zero expected amount means any amount is fine.
+func paymentStatus(expected, received *big.Int, toleranceBPS int) models.DepositStatus {
+	if expected.Sign() == 0 {
+		return models.DepositStatusPaid
+	}
+
+	tolerance := new(big.Int).Mul(expected, big.NewInt(int64(toleranceBPS)))
+	tolerance.Quo(tolerance, big.NewInt(10000))
+
+	diff := new(big.Int).Sub(received, expected)
+	switch {
+	case new(big.Int).Abs(diff).Cmp(tolerance) <= 0:
+		return models.DepositStatusPaid
+	case diff.Sign() < 0:
+		return models.DepositStatusUnderpaid
+	default:
+		return models.DepositStatusOverpaid
+	}
+}
+
+// parseAmount parses decimal base units amount, empty string is zero
+func parseAmount(amount string) (*big.Int, bool) {
+	if amount == "" {
+		return new(big.Int), true
+	}
+	v, ok := new(big.Int).SetString(amount, 10)
+	if !ok || v.Sign() < 0 {
+		return nil, false
+	}
+	return v, true
+}
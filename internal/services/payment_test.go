@@ -0,0 +1,38 @@
+package services
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+func TestPaymentStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		expected     int64
+		received     int64
+		toleranceBPS int
+		want         models.DepositStatus
+	}{
+		{name: "any amount", expected: 0, received: 1, want: models.DepositStatusPaid},
+		{name: "exact", expected: 10000, received: 10000, want: models.DepositStatusPaid},
+		{name: "under", expected: 10000, received: 9999, want: models.DepositStatusUnderpaid},
+		{name: "over", expected: 10000, received: 10001, want: models.DepositStatusOverpaid},
+		{name: "under within tolerance", expected: 10000, received: 9900, toleranceBPS: 100, want: models.DepositStatusPaid},
+		{name: "under past tolerance", expected: 10000, received: 9899, toleranceBPS: 100, want: models.DepositStatusUnderpaid},
+		{name: "over within tolerance", expected: 10000, received: 10100, toleranceBPS: 100, want: models.DepositStatusPaid},
+		{name: "over past tolerance", expected: 10000, received: 10101, toleranceBPS: 100, want: models.DepositStatusOverpaid},
+		{name: "tolerance rounds down", expected: 99, received: 98, toleranceBPS: 100, want: models.DepositStatusUnderpaid},
+		{name: "nothing received", expected: 10000, received: 0, toleranceBPS: 100, want: models.DepositStatusUnderpaid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := paymentStatus(big.NewInt(tt.expected), big.NewInt(tt.received), tt.toleranceBPS)
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
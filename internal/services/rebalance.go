@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/keystore"
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/storage"
+)
+
+// Sent transfer without saved raw tx that node doesn't know is failed after this long
+const walletTransferTimeout = time.Hour
+
+// RebalancePolicy defines hot wallet balance thresholds for chain (wei)
+type RebalancePolicy struct {
+	MinBalance    *big.Int
+	TargetBalance *big.Int
+	MaxBalance    *big.Int
+	ColdAddress   string
+}
+
+// NewRebalancePolicy parses policy from decimal wei strings. Returns nil if cold address is empty (rebalancing disabled).
+func NewRebalancePolicy(minBalance, targetBalance, maxBalance, coldAddress string) (*RebalancePolicy, error) {
+	if coldAddress == "" {
+		return nil, nil
+	}
+
+	parse := func(name, value string) (*big.Int, error) {
+		v, ok := new(big.Int).SetString(value, 10)
+		if !ok || v.Sign() < 0 {
+			return nil, fmt.Errorf("invalid %s: %q", name, value)
+		}
+		return v, nil
+	}
+
+	minValue, err := parse("min balance", minBalance)
+	if err != nil {
+		return nil, err
+	}
+	targetValue, err := parse("target balance", targetBalance)
+	if err != nil {
+		return nil, err
+	}
+	maxValue, err := parse("max balance", maxBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	if minValue.Cmp(targetValue) > 0 || targetValue.Cmp(maxValue) > 0 {
+		return nil, fmt.Errorf("balances must satisfy min <= target <= max")
+	}
+
+	return &RebalancePolicy{
+		MinBalance:    minValue,
+		TargetBalance: targetValue,
+		MaxBalance:    maxValue,
+		ColdAddress:   coldAddress,
+	}, nil
+}
+
+// RebalanceService keeps hot wallet balance between min and max.
+// Excess is sent to cold wallet, shortage creates refill request which is signed offline.
+type RebalanceService struct {
+	storage  storage.Storage
+	adapters map[models.Chain]adapters.BlockchainAdapter
+	keys     *keystore.Keystore
+	policies map[models.Chain]*RebalancePolicy
+}
+
+func NewRebalanceService(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter, keys *keystore.Keystore, policies map[models.Chain]*RebalancePolicy) *RebalanceService {
+	return &RebalanceService{
+		storage:  storage,
+		adapters: adapters,
+		keys:     keys,
+		policies: policies,
+	}
+}
+
+// Rebalance checks hot wallet balances for all chains with policy
+func (s *RebalanceService) Rebalance(ctx context.Context) {
+	for chain := range s.policies {
+		if err := s.rebalanceChain(ctx, chain); err != nil {
+			fmt.Printf("Error rebalancing %s: %v\n", chain, err)
+		}
+	}
+}
+
+type hotWalletBalance struct {
+	wallet  *models.HotWallet
+	balance *big.Int
+}
+
+func (s *RebalanceService) rebalanceChain(ctx context.Context, chain models.Chain) error {
+	policy := s.policies[chain]
+	adapter, ok := s.adapters[chain]
+	if !ok {
+		return fmt.Errorf("chain %s not supported", chain)
+	}
+
+	// Update status of transfers in flight first
+	open, err := s.storage.GetOpenWalletTransfers(chain)
+	if err != nil {
+		return fmt.Errorf("failed to get open transfers: %w", err)
+	}
+	open = s.checkSentTransfers(ctx, adapter, open)
+
+	wallets, err := s.storage.GetActiveHotWallets(chain)
+	if err != nil {
+		return fmt.Errorf("failed to get hot wallets: %w", err)
+	}
+	if len(wallets) == 0 {
+		return nil
+	}
+
+	total := new(big.Int)
+	balances := make([]hotWalletBalance, 0, len(wallets))
+	for _, wallet := range wallets {
+		balance, err := adapter.GetBalance(ctx, wallet.Address)
+		if err != nil {
+			return fmt.Errorf("failed to get balance: %w", err)
+		}
+		if err := s.storage.UpdateHotWalletBalance(wallet.ID, balance.String()); err != nil {
+			fmt.Printf("Warning: failed to update cached balance: %v\n", err)
+		}
+		total.Add(total, balance)
+		balances = append(balances, hotWalletBalance{wallet: wallet, balance: balance})
+	}
+
+	// One open transfer per chain, wait until it settles
+	if len(open) > 0 {
+		return nil
+	}
+
+	switch {
+	case total.Cmp(policy.MaxBalance) > 0:
+		excess := new(big.Int).Sub(total, policy.TargetBalance)
+		return s.sweepToCold(ctx, adapter, chain, policy, balances, excess)
+	case total.Cmp(policy.MinBalance) < 0:
+		shortage := new(big.Int).Sub(policy.TargetBalance, total)
+		return s.requestRefill(chain, policy, balances, shortage)
+	}
+	return nil
+}
+
+// sweepToCold sends excess from the largest hot wallet to cold address
+func (s *RebalanceService) sweepToCold(ctx context.Context, adapter adapters.BlockchainAdapter, chain models.Chain, policy *RebalancePolicy, balances []hotWalletBalance, amount *big.Int) error {
+	source := balances[0]
+	for _, b := range balances[1:] {
+		if b.balance.Cmp(source.balance) > 0 {
+			source = b
+		}
+	}
+
+	// Single wallet may hold less than total excess, fee is taken off once tx is built
+	if source.balance.Cmp(amount) < 0 {
+		amount = new(big.Int).Set(source.balance)
+	}
+	if amount.Sign() <= 0 {
+		return nil
+	}
+
+	transfer := &models.WalletTransfer{
+		Chain:       chain,
+		Direction:   models.WalletTransferHotToCold,
+		FromAddress: source.wallet.Address,
+		ToAddress:   policy.ColdAddress,
+		Amount:      amount.String(),
+		Status:      models.WalletTransferStatusRequested,
+	}
+	if err := s.storage.CreateWalletTransfer(transfer); err != nil {
+		if errors.Is(err, storage.ErrOpenTransferExists) {
+			// Another instance created transfer first
+			return nil
+		}
+		return fmt.Errorf("failed to create transfer: %w", err)
+	}
+
+	// Wallet is locked from nonce lookup to broadcast, withdrawals from it wait
+	err := s.storage.WithHotWalletLock(ctx, chain, source.wallet.Address, func() error {
+		return s.signAndSendSweep(ctx, adapter, transfer, source.wallet, source.balance, amount)
+	})
+	if err != nil && transfer.Status == models.WalletTransferStatusRequested {
+		// Wallet wasn't locked, transfer must not stay open
+		return s.failTransfer(transfer, err)
+	}
+	return err
+}
+
+// signAndSendSweep signs sweep transfer from wallet, saves it and broadcasts it.
+// Amount is cut so balance covers fee of built tx (cold wallet may be contract needing more than 21000 gas).
+func (s *RebalanceService) signAndSendSweep(ctx context.Context, adapter adapters.BlockchainAdapter, transfer *models.WalletTransfer, wallet *models.HotWallet, balance, amount *big.Int) error {
+	unsigned, err := adapter.BuildTransaction(ctx, wallet.Address, transfer.ToAddress, amount)
+	if err != nil {
+		return s.failTransfer(transfer, fmt.Errorf("failed to build transaction: %w", err))
+	}
+	gasPrice, ok := new(big.Int).SetString(unsigned.GasPrice, 10)
+	if !ok {
+		return s.failTransfer(transfer, fmt.Errorf("invalid gas price: %s", unsigned.GasPrice))
+	}
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(unsigned.Gas))
+	available := new(big.Int).Sub(balance, fee)
+	if available.Cmp(amount) < 0 {
+		amount = available
+	}
+	if amount.Sign() <= 0 {
+		return s.failTransfer(transfer, fmt.Errorf("balance %s doesn't cover fee %s", balance, fee))
+	}
+	unsigned.Value = amount.String()
+	transfer.Amount = amount.String()
+
+	signed, err := adapter.SignTransaction(ctx, unsigned, s.keys.KeyFunc(wallet.EncryptedKey))
+	if err != nil {
+		return s.failTransfer(transfer, fmt.Errorf("failed to sign transaction: %w", err))
+	}
+
+	// Signed tx is saved before broadcast, failed broadcast may still land and is reconciled
+	// by checkSentTransfers instead of failing transfer
+	transfer.TxHash = signed.Hash
+	transfer.RawTx = signed.RawTx
+	transfer.Status = models.WalletTransferStatusSent
+	now := time.Now()
+	transfer.SentAt = &now
+	if err := s.storage.UpdateWalletTransfer(transfer); err != nil {
+		return fmt.Errorf("failed to save signed transfer: %w", err)
+	}
+
+	if _, err := adapter.SendRawTransaction(ctx, signed.RawTx); err != nil {
+		if rejectedPermanently(err) {
+			return s.failTransfer(transfer, fmt.Errorf("transaction rejected: %w", err))
+		}
+		fmt.Printf("Warning: hot wallet sweep %d broadcast failed, it will be rebroadcast: %v\n", transfer.ID, err)
+		return nil
+	}
+
+	fmt.Printf("Hot wallet sweep sent: chain=%s, amount=%s, tx_hash=%s\n", transfer.Chain, transfer.Amount, transfer.TxHash)
+	return nil
+}
+
+// requestRefill records cold -> hot transfer, it has to be signed offline
+func (s *RebalanceService) requestRefill(chain models.Chain, policy *RebalancePolicy, balances []hotWalletBalance, amount *big.Int) error {
+	target := balances[0]
+	for _, b := range balances[1:] {
+		if b.balance.Cmp(target.balance) < 0 {
+			target = b
+		}
+	}
+
+	transfer := &models.WalletTransfer{
+		Chain:       chain,
+		Direction:   models.WalletTransferColdToHot,
+		FromAddress: policy.ColdAddress,
+		ToAddress:   target.wallet.Address,
+		Amount:      amount.String(),
+		Status:      models.WalletTransferStatusRequested,
+	}
+	if err := s.storage.CreateWalletTransfer(transfer); err != nil {
+		if errors.Is(err, storage.ErrOpenTransferExists) {
+			return nil
+		}
+		return fmt.Errorf("failed to create refill request: %w", err)
+	}
+
+	// TODO: notify ops
+	fmt.Printf("Hot wallet refill requested: chain=%s, id=%d, amount=%s\n", chain, transfer.ID, transfer.Amount)
+	return nil
+}
+
+// checkSentTransfers updates sent transfers from chain, returns transfers still open
+func (s *RebalanceService) checkSentTransfers(ctx context.Context, adapter adapters.BlockchainAdapter, transfers []*models.WalletTransfer) []*models.WalletTransfer {
+	var open []*models.WalletTransfer
+	for _, transfer := range transfers {
+		if transfer.Status != models.WalletTransferStatusSent {
+			open = append(open, transfer)
+			continue
+		}
+
+		status, err := adapter.GetTransactionStatus(ctx, transfer.TxHash)
+		if errors.Is(err, adapters.ErrTransactionNotFound) {
+			if s.rebroadcastTransfer(ctx, adapter, transfer) {
+				open = append(open, transfer)
+			}
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to get status of transfer %d: %v\n", transfer.ID, err)
+			open = append(open, transfer)
+			continue
+		}
+		if status.Status == "pending" {
+			open = append(open, transfer)
+			continue
+		}
+
+		if status.Success {
+			transfer.Status = models.WalletTransferStatusConfirmed
+			now := time.Now()
+			transfer.ConfirmedAt = &now
+		} else {
+			transfer.Status = models.WalletTransferStatusFailed
+		}
+		if err := s.storage.UpdateWalletTransfer(transfer); err != nil {
+			fmt.Printf("Warning: failed to update transfer %d: %v\n", transfer.ID, err)
+			open = append(open, transfer)
+		}
+	}
+	return open
+}
+
+// rebroadcastTransfer sends saved tx again when node doesn't know it (broadcast failed or tx was dropped
+// from mempool). Tx whose nonce was taken by another one can't land anymore, its transfer fails.
+// Returns whether transfer is still open.
+func (s *RebalanceService) rebroadcastTransfer(ctx context.Context, adapter adapters.BlockchainAdapter, transfer *models.WalletTransfer) bool {
+	if transfer.RawTx == "" {
+		// Sent before raw txs were saved, nothing to rebroadcast
+		if transfer.SentAt != nil && time.Since(*transfer.SentAt) < walletTransferTimeout {
+			return true
+		}
+		err := s.failTransfer(transfer, fmt.Errorf("transaction %s not found", transfer.TxHash))
+		fmt.Printf("Wallet transfer failed: chain=%s, id=%d, %v\n", transfer.Chain, transfer.ID, err)
+		return false
+	}
+
+	_, err := adapter.SendRawTransaction(ctx, transfer.RawTx)
+	if errors.Is(err, adapters.ErrNonceTooLow) {
+		// Ours may have been mined since status check, then it's confirmed on next run
+		if _, statusErr := adapter.GetTransactionStatus(ctx, transfer.TxHash); !errors.Is(statusErr, adapters.ErrTransactionNotFound) {
+			return true
+		}
+		err := s.failTransfer(transfer, fmt.Errorf("nonce of transaction %s used by another transaction", transfer.TxHash))
+		fmt.Printf("Wallet transfer failed: chain=%s, id=%d, %v\n", transfer.Chain, transfer.ID, err)
+		return false
+	}
+	if rejectedPermanently(err) {
+		// Node won't ever take this tx and its nonce stays free, next rebalance signs new one
+		err := s.failTransfer(transfer, fmt.Errorf("transaction %s rejected: %w", transfer.TxHash, err))
+		fmt.Printf("Wallet transfer failed: chain=%s, id=%d, %v\n", transfer.Chain, transfer.ID, err)
+		return false
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to rebroadcast transfer %d: %v\n", transfer.ID, err)
+		return true
+	}
+
+	fmt.Printf("Wallet transfer rebroadcast: chain=%s, id=%d, tx_hash=%s\n", transfer.Chain, transfer.ID, transfer.TxHash)
+	return true
+}
+
+// rejectedPermanently reports whether node refused signed tx for good, e.g. it costs more than wallet has
+func rejectedPermanently(err error) bool {
+	return errors.Is(err, adapters.ErrInsufficientFunds) || errors.Is(err, adapters.ErrInvalidSender)
+}
+
+func (s *RebalanceService) failTransfer(transfer *models.WalletTransfer, cause error) error {
+	transfer.Status = models.WalletTransferStatusFailed
+	if err := s.storage.UpdateWalletTransfer(transfer); err != nil {
+		fmt.Printf("Warning: failed to update transfer %d: %v\n", transfer.ID, err)
+	}
+	return cause
+}
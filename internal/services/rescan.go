@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/dechat/exchange-service/internal/storage"
+)
+
+const (
+	// Progress is saved every rescanBatchSize blocks, it's also job heartbeat
+	rescanBatchSize = 50
+	// Running job without heartbeat for this long is taken over by another worker
+	rescanStaleAfter = 5 * time.Minute
+	// Block is tried this many times before it's recorded as failed and skipped
+	rescanBlockAttempts = 3
+	rescanRetryDelay    = 5 * time.Second
+)
+
+// RescanService reprocesses block ranges with deposit monitor logic.
+// Transfers are deduplicated by (chain, tx_hash, log_index), so rescanning
+// blocks already seen by live monitor doesn't credit deposits twice.
+type RescanService struct {
+	storage storage.Storage
+	monitor *DepositMonitor
+}
+
+func NewRescanService(storage storage.Storage, monitor *DepositMonitor) *RescanService {
+	return &RescanService{
+		storage: storage,
+		monitor: monitor,
+	}
+}
+
+// CreateJob queues rescan of blocks [fromBlock, toBlock]
+func (s *RescanService) CreateJob(ctx context.Context, chain models.Chain, fromBlock, toBlock int64) (*models.RescanJob, error) {
+	adapter, ok := s.monitor.adapters[chain]
+	if !ok {
+		return nil, fmt.Errorf("chain %s not supported", chain)
+	}
+	if fromBlock < 0 || fromBlock > toBlock {
+		return nil, fmt.Errorf("invalid block range %d-%d", fromBlock, toBlock)
+	}
+
+	latestBlock, err := adapter.GetLatestBlock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	if toBlock > latestBlock {
+		return nil, fmt.Errorf("block %d is beyond chain head %d", toBlock, latestBlock)
+	}
+
+	job := &models.RescanJob{
+		Chain:     chain,
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+		NextBlock: fromBlock,
+		Status:    models.RescanJobStatusQueued,
+	}
+	if err := s.storage.CreateRescanJob(job); err != nil {
+		return nil, fmt.Errorf("failed to create rescan job: %w", err)
+	}
+	return job, nil
+}
+
+// GetJob returns rescan job by id
+func (s *RescanService) GetJob(ctx context.Context, id int64) (*models.RescanJob, error) {
+	job, err := s.storage.GetRescanJob(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rescan job: %w", err)
+	}
+	if job == nil {
+		return nil, fmt.Errorf("rescan job %d not found", id)
+	}
+	return job, nil
+}
+
+// ListJobs returns latest rescan jobs
+func (s *RescanService) ListJobs(ctx context.Context) ([]*models.RescanJob, error) {
+	jobs, err := s.storage.ListRescanJobs(100)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rescan jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// ProcessJobs runs queued jobs for supported chains one by one until none is left
+func (s *RescanService) ProcessJobs(ctx context.Context) error {
+	chains := make([]models.Chain, 0, len(s.monitor.adapters))
+	for chain := range s.monitor.adapters {
+		chains = append(chains, chain)
+	}
+
+	for ctx.Err() == nil {
+		job, err := s.storage.ClaimRescanJob(chains, rescanStaleAfter)
+		if err != nil {
+			return fmt.Errorf("failed to claim rescan job: %w", err)
+		}
+		if job == nil {
+			return nil
+		}
+		s.runJob(ctx, job)
+	}
+	return nil
+}
+
+// runJob processes job blocks. Block that keeps failing is recorded in job's failed blocks
+// and skipped, so one bad block doesn't stop the whole range.
+func (s *RescanService) runJob(ctx context.Context, job *models.RescanJob) {
+	fmt.Printf("Rescan started: id=%d, chain=%s, blocks=%d-%d, next=%d\n", job.ID, job.Chain, job.FromBlock, job.ToBlock, job.NextBlock)
+
+	for job.NextBlock <= job.ToBlock {
+		if ctx.Err() != nil {
+			// Shutdown, job is taken over once heartbeat gets stale
+			s.saveJob(job)
+			return
+		}
+
+		if err := s.rescanBlock(ctx, job.Chain, job.NextBlock); err != nil {
+			if ctx.Err() != nil {
+				s.saveJob(job)
+				return
+			}
+			job.FailedBlocks = append(job.FailedBlocks, job.NextBlock)
+			job.Error = fmt.Sprintf("block %d: %v", job.NextBlock, err)
+			fmt.Printf("Rescan block failed, skipped: id=%d, chain=%s, %s\n", job.ID, job.Chain, job.Error)
+			job.NextBlock++
+			s.saveJob(job)
+			continue
+		}
+		job.NextBlock++
+
+		if (job.NextBlock-job.FromBlock)%rescanBatchSize == 0 {
+			s.saveJob(job)
+		}
+	}
+
+	job.Status = models.RescanJobStatusCompleted
+	now := time.Now()
+	job.FinishedAt = &now
+	s.saveJob(job)
+	fmt.Printf("Rescan completed: id=%d, chain=%s, blocks=%d-%d, failed=%d\n", job.ID, job.Chain, job.FromBlock, job.ToBlock, len(job.FailedBlocks))
+}
+
+// rescanBlock processes block, retrying transient errors
+func (s *RescanService) rescanBlock(ctx context.Context, chain models.Chain, blockNumber int64) error {
+	var err error
+	for attempt := 1; attempt <= rescanBlockAttempts; attempt++ {
+		if err = s.monitor.rescanBlock(ctx, chain, blockNumber); err == nil {
+			return nil
+		}
+		if attempt == rescanBlockAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rescanRetryDelay):
+		}
+	}
+	return err
+}
+
+func (s *RescanService) saveJob(job *models.RescanJob) {
+	if err := s.storage.UpdateRescanJob(job); err != nil {
+		fmt.Printf("Warning: failed to update rescan job %d: %v\n", job.ID, err)
+	}
+}
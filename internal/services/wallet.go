@@ -4,61 +4,114 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/metrics"
 	"github.com/dechat/exchange-service/internal/models"
 	"github.com/dechat/exchange-service/internal/storage"
 )
 
 type WalletService struct {
-	storage storage.Storage
-	adapters map[models.Chain]adapters.BlockchainAdapter
+	storage     storage.Storage
+	adapters    map[models.Chain]adapters.BlockchainAdapter
+	withdrawals *WithdrawalService
+	expiry      DepositExpiry
+	index       *AddressIndex
 }
 
-func NewWalletService(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter) *WalletService {
+// DepositExpiry defines how long deposit waits for payment.
+// Zero TTL means deposits never expire.
+type DepositExpiry struct {
+	TTL             time.Duration
+	LateGracePeriod time.Duration
+}
+
+func NewWalletService(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter, withdrawals *WithdrawalService, expiry DepositExpiry, index *AddressIndex) *WalletService {
 	return &WalletService{
-		storage: storage,
-		adapters: adapters,
+		storage:     storage,
+		adapters:    adapters,
+		withdrawals: withdrawals,
+		expiry:      expiry,
+		index:       index,
 	}
 }
 
-// GenerateDepositAddress generates new deposit address for user
-func (s *WalletService) GenerateDepositAddress(ctx context.Context, chain models.Chain, userID, orderID string) (string, error) {
+// GenerateDepositAddress generates new deposit address for user.
+// Asset is "native" (or empty) or token contract address, expected amount is in base units.
+func (s *WalletService) GenerateDepositAddress(ctx context.Context, chain models.Chain, userID, orderID, asset, expectedAmount string) (*models.Deposit, error) {
 	adapter, ok := s.adapters[chain]
 	if !ok {
-		return "", fmt.Errorf("chain %s not supported", chain)
+		return nil, fmt.Errorf("chain %s not supported", chain)
 	}
 
-	address, err := adapter.GenerateAddress(ctx)
+	asset, err := adapters.NormalizeAsset(asset)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate address: %w", err)
+		return nil, err
+	}
+
+	expected, ok := parseAmount(expectedAmount)
+	if !ok {
+		return nil, fmt.Errorf("invalid expected amount: %s", expectedAmount)
 	}
 
 	// Save deposit record
 	deposit := &models.Deposit{
 		Chain:          chain,
-		Address:        address,
 		UserID:         userID,
 		OrderID:        orderID,
-		ExpectedAmount: "0", // TODO: get from order
+		Mode:           models.DepositModeOrder,
+		Asset:          asset,
+		ExpectedAmount: expected.String(),
 		Status:         models.DepositStatusPending,
 	}
-
-	if err := s.storage.CreateDeposit(deposit); err != nil {
-		return "", fmt.Errorf("failed to save deposit: %w", err)
+	if s.expiry.TTL > 0 {
+		expiresAt := time.Now().Add(s.expiry.TTL)
+		watchUntil := expiresAt.Add(s.expiry.LateGracePeriod)
+		deposit.ExpiresAt = &expiresAt
+		deposit.WatchUntil = &watchUntil
 	}
 
-	return address, nil
+	if err := s.createDeposit(ctx, adapter, deposit); err != nil {
+		return nil, err
+	}
+	s.setPaymentURI(deposit)
+	return deposit, nil
 }
 
-// GetBalance returns balance of hot wallet
-func (s *WalletService) GetBalance(ctx context.Context, chain models.Chain) (*big.Int, error) {
-	wallet, err := s.storage.GetHotWallet(chain)
+// createDeposit saves deposit with address from pool, falls back to generating one when pool is empty
+func (s *WalletService) createDeposit(ctx context.Context, adapter adapters.BlockchainAdapter, deposit *models.Deposit) error {
+	chain := string(deposit.Chain)
+	claimed, err := s.storage.CreateDepositFromPool(deposit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get hot wallet: %w", err)
+		return fmt.Errorf("failed to save deposit: %w", err)
 	}
-	if wallet == nil {
-		return nil, fmt.Errorf("hot wallet not found for chain %s", chain)
+
+	if claimed {
+		metrics.AddressPoolClaims.WithLabelValues(chain).Inc()
+		metrics.AddressPoolAvailable.WithLabelValues(chain).Dec()
+	} else {
+		metrics.AddressPoolMisses.WithLabelValues(chain).Inc()
+
+		address, err := adapter.GenerateAddress(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to generate address: %w", err)
+		}
+		deposit.Address = address
+		if err := s.storage.CreateDeposit(deposit); err != nil {
+			return fmt.Errorf("failed to save deposit: %w", err)
+		}
+	}
+
+	s.index.Add(deposit.Chain, deposit.Address)
+	return nil
+}
+
+// GetStaticAddress returns user's permanent deposit address for chain, creating it on first call.
+// Static address never expires and accepts any asset, every transfer is credited to the user.
+func (s *WalletService) GetStaticAddress(ctx context.Context, chain models.Chain, userID string) (*models.Deposit, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("user id is required")
 	}
 
 	adapter, ok := s.adapters[chain]
@@ -66,18 +119,237 @@ func (s *WalletService) GetBalance(ctx context.Context, chain models.Chain) (*bi
 		return nil, fmt.Errorf("chain %s not supported", chain)
 	}
 
-	balance, err := adapter.GetBalance(ctx, wallet.Address)
+	deposit, err := s.storage.GetStaticDeposit(chain, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get static address: %w", err)
+	}
+	if deposit != nil {
+		s.setPaymentURI(deposit)
+		return deposit, nil
+	}
+
+	deposit = &models.Deposit{
+		Chain:          chain,
+		UserID:         userID,
+		Mode:           models.DepositModeStatic,
+		Asset:          adapters.NativeAsset,
+		ExpectedAmount: "0",
+		Status:         models.DepositStatusPending,
+	}
+	if err := s.createDeposit(ctx, adapter, deposit); err != nil {
+		// Concurrent request may have created it first
+		existing, getErr := s.storage.GetStaticDeposit(chain, userID)
+		if getErr == nil && existing != nil {
+			s.setPaymentURI(existing)
+			return existing, nil
+		}
+		return nil, err
+	}
+	s.setPaymentURI(deposit)
+
+	return deposit, nil
+}
+
+// GetUserCredits returns incoming transfers to user's static addresses
+func (s *WalletService) GetUserCredits(ctx context.Context, chain models.Chain, userID string) ([]*models.DepositTransfer, error) {
+	credits, err := s.storage.GetUserCredits(chain, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user credits: %w", err)
+	}
+	return credits, nil
+}
+
+// ListWrongAssetTransfers returns transfers of unexpected asset to deposit addresses, ops refund them manually
+func (s *WalletService) ListWrongAssetTransfers(ctx context.Context, chain models.Chain) ([]*models.DepositTransfer, error) {
+	transfers, err := s.storage.GetWrongAssetTransfers(chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wrong asset transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// GetDeposit returns deposit by id with its incoming transfers
+func (s *WalletService) GetDeposit(ctx context.Context, id int64) (*models.Deposit, error) {
+	deposit, err := s.storage.GetDepositByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deposit: %w", err)
+	}
+	if deposit == nil {
+		return nil, fmt.Errorf("deposit %d not found", id)
+	}
+
+	deposit.Transfers, err = s.storage.GetDepositTransfers(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deposit transfers: %w", err)
+	}
+	s.setPaymentURI(deposit)
+	return deposit, nil
+}
+
+// setPaymentURI fills payment link for wallets, amount is only included for per-order deposits
+func (s *WalletService) setPaymentURI(deposit *models.Deposit) {
+	adapter, ok := s.adapters[deposit.Chain]
+	if !ok {
+		return
+	}
+	var amount *big.Int
+	if deposit.Mode != models.DepositModeStatic {
+		amount, _ = parseAmount(deposit.ExpectedAmount)
+	}
+	deposit.PaymentURI = adapter.PaymentURI(deposit.Address, deposit.Asset, amount)
+}
+
+// ExpireDeposits expires pending deposits nobody paid before TTL.
+// Address is still watched during grace period, payments then make deposit late.
+func (s *WalletService) ExpireDeposits(ctx context.Context) error {
+	deposits, err := s.storage.ExpireDeposits()
+	if err != nil {
+		return fmt.Errorf("failed to expire deposits: %w", err)
+	}
+
+	for _, deposit := range deposits {
+		// TODO: Send webhook/event about deposit expiry
+		fmt.Printf("Deposit expired: chain=%s, order_id=%s, address=%s\n", deposit.Chain, deposit.OrderID, deposit.Address)
+	}
+	return nil
+}
+
+// ResolveDeposit records order system decision for underpaid, overpaid or late deposit.
+// Refund sends back whole amount for underpaid and late deposit and the excess for overpaid one.
+// Decision is saved only if deposit didn't change since it was read, otherwise ErrDepositChanged.
+func (s *WalletService) ResolveDeposit(ctx context.Context, id int64, resolution models.DepositResolution, refundAddress string) (*models.Deposit, error) {
+	deposit, err := s.GetDeposit(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get balance: %w", err)
+		return nil, err
+	}
+
+	if deposit.Mode == models.DepositModeStatic {
+		return nil, fmt.Errorf("deposit %d is static address, it has nothing to resolve", id)
+	}
+	switch deposit.Status {
+	case models.DepositStatusUnderpaid, models.DepositStatusOverpaid, models.DepositStatusLate:
+	default:
+		return nil, fmt.Errorf("deposit %d is %s, only underpaid, overpaid or late deposits can be resolved", id, deposit.Status)
+	}
+	if deposit.Resolution != models.DepositResolutionNone && deposit.Resolution != models.DepositResolutionTopUp {
+		return nil, fmt.Errorf("deposit %d is already resolved: %s", id, deposit.Resolution)
+	}
+	previous := deposit.Resolution
+
+	switch resolution {
+	case models.DepositResolutionTopUp:
+		if deposit.Status != models.DepositStatusUnderpaid {
+			return nil, fmt.Errorf("top up is only possible for underpaid deposit")
+		}
+	case models.DepositResolutionAccept:
+	case models.DepositResolutionRefund:
+		if refundAddress == "" {
+			return nil, fmt.Errorf("refund address is required")
+		}
+		refund, err := refundAmount(deposit)
+		if err != nil {
+			return nil, err
+		}
+		deposit.RefundAddress = refundAddress
+		deposit.RefundAmount = refund.String()
+	default:
+		return nil, fmt.Errorf("unknown resolution: %s", resolution)
+	}
+
+	deposit.Resolution = resolution
+	if err := s.storage.ResolveDeposit(deposit); err != nil {
+		return nil, fmt.Errorf("failed to resolve deposit %d: %w", id, err)
+	}
+
+	if resolution == models.DepositResolutionRefund {
+		if err := s.refundDeposit(ctx, deposit, previous); err != nil {
+			return nil, err
+		}
+	}
+	return deposit, nil
+}
+
+// refundAmount returns what refund of deposit sends back
+func refundAmount(deposit *models.Deposit) (*big.Int, error) {
+	// TODO: token refunds, withdrawals only send native coin for now
+	if deposit.Asset != adapters.NativeAsset {
+		return nil, fmt.Errorf("deposit %d is %s, only native coin deposits can be refunded, accept it and refund manually", deposit.ID, deposit.Asset)
+	}
+
+	received, ok := parseAmount(deposit.ReceivedAmount)
+	if !ok {
+		return nil, fmt.Errorf("invalid received amount: %s", deposit.ReceivedAmount)
 	}
 
-	// Update cached balance
-	balanceStr := balance.String()
-	if err := s.storage.UpdateHotWalletBalance(chain, balanceStr); err != nil {
-		// Log error but don't fail
-		fmt.Printf("Warning: failed to update cached balance: %v\n", err)
+	refund := received
+	if deposit.Status == models.DepositStatusOverpaid {
+		expected, ok := parseAmount(deposit.ExpectedAmount)
+		if !ok {
+			return nil, fmt.Errorf("invalid expected amount: %s", deposit.ExpectedAmount)
+		}
+		refund = new(big.Int).Sub(received, expected)
+	}
+	if refund.Sign() <= 0 {
+		return nil, fmt.Errorf("nothing to refund for deposit %d, received amount is not confirmed yet", deposit.ID)
 	}
+	return refund, nil
+}
 
-	return balance, nil
+// refundDeposit creates refund withdrawal of deposit resolved with refund.
+// If it can't be created, deposit gets previous resolution back and can be resolved again.
+func (s *WalletService) refundDeposit(ctx context.Context, deposit *models.Deposit, previous models.DepositResolution) error {
+	orderID := fmt.Sprintf("deposit-refund-%d", deposit.ID)
+	withdrawal, _, err := s.withdrawals.CreateWithdrawal(ctx, WithdrawalRequest{
+		Chain:          deposit.Chain,
+		UserID:         deposit.UserID,
+		OrderID:        orderID,
+		IdempotencyKey: internalKeyPrefix + orderID,
+		ToAddress:      deposit.RefundAddress,
+		Amount:         deposit.RefundAmount,
+		internal:       true,
+	})
+	if err != nil {
+		if reopenErr := s.storage.ReopenDepositResolution(deposit.ID, previous); reopenErr != nil {
+			fmt.Printf("Warning: failed to reopen deposit %d after failed refund: %v\n", deposit.ID, reopenErr)
+		}
+		return fmt.Errorf("failed to create refund: %w", err)
+	}
+	if err := s.storage.SetDepositRefundWithdrawal(deposit.ID, withdrawal.ID); err != nil {
+		return fmt.Errorf("failed to link refund withdrawal %d: %w", withdrawal.ID, err)
+	}
+	deposit.RefundWithdrawalID = &withdrawal.ID
+	return nil
 }
 
+// GetBalance returns total balance of active hot wallets for chain
+func (s *WalletService) GetBalance(ctx context.Context, chain models.Chain) (*big.Int, error) {
+	wallets, err := s.storage.GetActiveHotWallets(chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hot wallets: %w", err)
+	}
+	if len(wallets) == 0 {
+		return nil, fmt.Errorf("hot wallet not found for chain %s", chain)
+	}
+
+	adapter, ok := s.adapters[chain]
+	if !ok {
+		return nil, fmt.Errorf("chain %s not supported", chain)
+	}
+
+	total := new(big.Int)
+	for _, wallet := range wallets {
+		balance, err := adapter.GetBalance(ctx, wallet.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get balance: %w", err)
+		}
+		total.Add(total, balance)
+
+		// Update cached balance
+		if err := s.storage.UpdateHotWalletBalance(wallet.ID, balance.String()); err != nil {
+			// Log error but don't fail
+			fmt.Printf("Warning: failed to update cached balance: %v\n", err)
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// WalletStrategy defines how hot wallet is picked for withdrawal
+type WalletStrategy string
+
+const (
+	// WalletStrategyBalance picks wallet with the largest balance
+	WalletStrategyBalance WalletStrategy = "balance"
+	// WalletStrategyLeastPending picks wallet with fewest unmined transactions
+	WalletStrategyLeastPending WalletStrategy = "least_pending"
+	// WalletStrategyRoundRobin rotates between wallets
+	WalletStrategyRoundRobin WalletStrategy = "round_robin"
+)
+
+// WalletSelector picks hot wallet to send withdrawal from.
+// Only wallets with sufficient balance are considered, whatever the strategy.
+type WalletSelector struct {
+	strategy WalletStrategy
+
+	mu   sync.Mutex
+	next map[models.Chain]int
+}
+
+func NewWalletSelector(strategy WalletStrategy) (*WalletSelector, error) {
+	switch strategy {
+	case "":
+		strategy = WalletStrategyBalance
+	case WalletStrategyBalance, WalletStrategyLeastPending, WalletStrategyRoundRobin:
+	default:
+		return nil, fmt.Errorf("unknown wallet strategy: %s", strategy)
+	}
+
+	return &WalletSelector{
+		strategy: strategy,
+		next:     make(map[models.Chain]int),
+	}, nil
+}
+
+type walletCandidate struct {
+	wallet  *models.HotWallet
+	balance *big.Int
+}
+
+// Select returns wallet able to cover amount it needs (value + fee). Fee may depend on sender,
+// so needed is called for every wallet, wallets it reports insufficient funds for are skipped.
+func (s *WalletSelector) Select(ctx context.Context, adapter adapters.BlockchainAdapter, wallets []*models.HotWallet, needed func(wallet *models.HotWallet) (*big.Int, error)) (*models.HotWallet, error) {
+	if len(wallets) == 0 {
+		return nil, fmt.Errorf("no active hot wallets")
+	}
+
+	var candidates []walletCandidate
+	for _, wallet := range wallets {
+		balance, err := adapter.GetBalance(ctx, wallet.Address)
+		if err != nil {
+			fmt.Printf("Warning: failed to get balance for %s: %v\n", wallet.Address, err)
+			continue
+		}
+		walletNeeds, err := needed(wallet)
+		if errors.Is(err, adapters.ErrInsufficientFunds) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if balance.Cmp(walletNeeds) < 0 {
+			continue
+		}
+		candidates = append(candidates, walletCandidate{wallet: wallet, balance: balance})
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("insufficient balance: no hot wallet can cover withdrawal")
+	}
+
+	switch s.strategy {
+	case WalletStrategyLeastPending:
+		return s.selectLeastPending(ctx, adapter, candidates)
+	case WalletStrategyRoundRobin:
+		return s.selectRoundRobin(wallets[0].Chain, candidates), nil
+	default:
+		return selectLargestBalance(candidates), nil
+	}
+}
+
+func selectLargestBalance(candidates []walletCandidate) *models.HotWallet {
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.balance.Cmp(best.balance) > 0 {
+			best = c
+		}
+	}
+	return best.wallet
+}
+
+func (s *WalletSelector) selectLeastPending(ctx context.Context, adapter adapters.BlockchainAdapter, candidates []walletCandidate) (*models.HotWallet, error) {
+	var best *models.HotWallet
+	bestPending := -1
+	for _, c := range candidates {
+		pending, err := adapter.GetPendingNonceCount(ctx, c.wallet.Address)
+		if err != nil {
+			fmt.Printf("Warning: failed to get pending nonces for %s: %v\n", c.wallet.Address, err)
+			continue
+		}
+		if bestPending < 0 || pending < bestPending {
+			best = c.wallet
+			bestPending = pending
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("failed to get pending nonces for all hot wallets")
+	}
+	return best, nil
+}
+
+func (s *WalletSelector) selectRoundRobin(chain models.Chain, candidates []walletCandidate) *models.HotWallet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.next[chain] % len(candidates)
+	s.next[chain] = i + 1
+	return candidates[i].wallet
+}
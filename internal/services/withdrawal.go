@@ -2,53 +2,154 @@ package services
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"math/big"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/keystore"
 	"github.com/dechat/exchange-service/internal/models"
 	"github.com/dechat/exchange-service/internal/storage"
 )
 
+const (
+	// Claimed withdrawal is recovered by another instance if not finished within lease
+	withdrawalLease = 2 * time.Minute
+	// Withdrawals claimed per chain on one run
+	withdrawalBatchSize = 10
+	// Retry delay after transient error, doubled on every attempt up to withdrawalRetryMaxDelay
+	withdrawalRetryDelay    = 10 * time.Second
+	withdrawalRetryMaxDelay = time.Hour
+	// Withdrawal without signed tx fails after this many attempts
+	withdrawalMaxAttempts = 10
+	// Gas quoted for contract destination on creation, limit is estimated from hot wallet when sending
+	contractGasReserve = 100000
+	// Sent tx unknown to node is rebroadcast after this delay, and fails if still not mined after timeout
+	withdrawalRebroadcastAfter = 5 * time.Minute
+	withdrawalDropTimeout      = time.Hour
+)
+
+// permanentError is withdrawal error retrying can't fix, withdrawal fails with it
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// isPermanent classifies withdrawal errors, everything not known to be permanent
+// (RPC errors, insufficient hot wallet funds, which get topped up) is transient.
+// Node rejecting tx for invalid sender is permanent, the same tx would be rejected again.
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p) ||
+		errors.Is(err, adapters.ErrInvalidAddress) ||
+		errors.Is(err, adapters.ErrExecutionReverted) ||
+		errors.Is(err, adapters.ErrInvalidSender)
+}
+
+// retryDelay returns backoff before given attempt
+func retryDelay(attempts int) time.Duration {
+	delay := withdrawalRetryDelay
+	for i := 1; i < attempts && delay < withdrawalRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > withdrawalRetryMaxDelay {
+		delay = withdrawalRetryMaxDelay
+	}
+	return delay
+}
+
 type WithdrawalService struct {
 	storage  storage.Storage
 	adapters map[models.Chain]adapters.BlockchainAdapter
-	encKey   []byte // TODO: load from secure config
+	keys     *keystore.Keystore
+	selector *WalletSelector
+	policy   WithdrawalPolicy
+	owner    string // lease owner id of this instance
+}
+
+// WithdrawalPolicy holds checks applied to new withdrawals
+type WithdrawalPolicy struct {
+	Approvals *ApprovalPolicy
+	// AddressCooldown is delay before new address book entry can be used or whitelist-only is turned off
+	AddressCooldown time.Duration
+	// WhitelistMerchants must name user of withdrawal, so user's whitelist applies
+	WhitelistMerchants map[string]bool
+	// RejectContracts rejects destinations with code, otherwise they are sent with estimated gas limit
+	RejectContracts bool
+	// ServiceFees is our fee per chain, chains without one are free
+	ServiceFees map[models.Chain]ServiceFee
+	Priorities  *PriorityPolicy
+	// Confirmations decides when sent withdrawal is final, chains without one use 1 block
+	Confirmations map[models.Chain]ChainMonitorConfig
 }
 
-func NewWithdrawalService(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter) *WithdrawalService {
-	// TODO: load encryption key from secure config
-	encKey := make([]byte, 32)
-	rand.Read(encKey)
+func (p WithdrawalPolicy) confirmation(chain models.Chain) ChainMonitorConfig {
+	config, ok := p.Confirmations[chain]
+	if !ok || config.Confirmation == "" {
+		return ChainMonitorConfig{Confirmation: ConfirmationBlocks, MinConfirmations: 1}
+	}
+	return config
+}
 
+// ErrInvalidDestination is returned for withdrawal to malformed address, zero address,
+// own hot wallet or rejected contract
+var ErrInvalidDestination = errors.New("invalid destination")
+
+func NewWithdrawalService(storage storage.Storage, adapters map[models.Chain]adapters.BlockchainAdapter, keys *keystore.Keystore, selector *WalletSelector, policy WithdrawalPolicy) *WithdrawalService {
 	return &WithdrawalService{
 		storage:  storage,
 		adapters: adapters,
-		encKey:   encKey,
+		keys:     keys,
+		selector: selector,
+		policy:   policy,
+		owner:    instanceID(),
 	}
 }
 
-// ProcessPendingWithdrawals processes pending withdrawals
-func (s *WithdrawalService) ProcessPendingWithdrawals(ctx context.Context, chain models.Chain) error {
-	withdrawals, err := s.storage.GetPendingWithdrawals(chain, 10)
+// instanceID identifies this process among service replicas
+func instanceID() string {
+	host, err := os.Hostname()
 	if err != nil {
-		return fmt.Errorf("failed to get pending withdrawals: %w", err)
+		host = "unknown"
 	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
 
+// ProcessPendingWithdrawals claims pending withdrawals and ones with expired lease and processes them.
+// Claiming skips rows locked by other instances, so replicas never send the same withdrawal twice.
+func (s *WithdrawalService) ProcessPendingWithdrawals(ctx context.Context, chain models.Chain) error {
 	adapter, ok := s.adapters[chain]
 	if !ok {
 		return fmt.Errorf("chain %s not supported", chain)
 	}
 
+	withdrawals, err := s.storage.ClaimWithdrawals(chain, s.owner, withdrawalLease, withdrawalBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to claim withdrawals: %w", err)
+	}
+
 	for _, withdrawal := range withdrawals {
-		if err := s.processWithdrawal(ctx, adapter, withdrawal); err != nil {
-			fmt.Printf("Error processing withdrawal %d: %v\n", withdrawal.ID, err)
+		if withdrawal.RawTx != "" {
+			// Lease of previous owner expired after tx was signed, it may be on chain already
+			err = s.recoverWithdrawal(ctx, adapter, withdrawal)
+		} else {
+			err = s.processWithdrawal(ctx, adapter, withdrawal)
+		}
+		if err != nil {
+			s.handleFailure(withdrawal, err)
 			// Continue with next withdrawal
 			continue
 		}
@@ -58,144 +159,575 @@ func (s *WithdrawalService) ProcessPendingWithdrawals(ctx context.Context, chain
 }
 
 func (s *WithdrawalService) processWithdrawal(ctx context.Context, adapter adapters.BlockchainAdapter, withdrawal *models.Withdrawal) error {
-	// Get hot wallet
-	wallet, err := s.storage.GetHotWallet(withdrawal.Chain)
+	wallets, err := s.storage.GetActiveHotWallets(withdrawal.Chain)
 	if err != nil {
-		return fmt.Errorf("failed to get hot wallet: %w", err)
+		return fmt.Errorf("failed to get hot wallets: %w", err)
 	}
-	if wallet == nil {
-		return fmt.Errorf("hot wallet not found for chain %s", withdrawal.Chain)
+
+	// Recipient gets amount less fees when merchant deducts them
+	amount, ok := new(big.Int).SetString(withdrawal.ReceiveAmount, 10)
+	if !ok || amount.Sign() <= 0 {
+		return permanent(fmt.Errorf("invalid amount: %s", withdrawal.ReceiveAmount))
 	}
 
-	// Check balance
-	balance, err := adapter.GetBalance(ctx, wallet.Address)
-	if err != nil {
-		return fmt.Errorf("failed to get balance: %w", err)
+	// Limits are checked again, withdrawal may have waited for approval or retries
+	// while other withdrawals used the window
+	if err := s.storage.CheckWithdrawalLimits(withdrawal); err != nil {
+		return fmt.Errorf("failed to check withdrawal limits: %w", err)
 	}
 
-	amount, ok := new(big.Int).SetString(withdrawal.Amount, 10)
-	if !ok {
-		return fmt.Errorf("invalid amount: %s", withdrawal.Amount)
+	// Address book is checked again, entry may have been deleted or re-added while withdrawal was queued
+	if err := s.checkDestination(withdrawal); err != nil {
+		if errors.Is(err, ErrDestinationNotAllowed) {
+			return permanent(err)
+		}
+		return err
 	}
 
-	// Get gas price
+	// Get gas price, low priority withdrawal is put back until gas is cheap
 	gasPrice, err := adapter.GetGasPrice(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get gas price: %w", err)
 	}
+	if reason := s.policy.Priorities.wait(withdrawal, gasPrice); reason != "" {
+		return s.deferWithdrawal(withdrawal, reason)
+	}
+	gasPrice = s.policy.Priorities.gasPrice(withdrawal.Priority, gasPrice)
+
+	// Pick hot wallet with sufficient balance for amount and fee at gas limit tx will have
+	// (21000 for simple transfer, estimate from that wallet for contract)
+	gasLimits := make(map[string]uint64)
+	wallet, err := s.selector.Select(ctx, adapter, wallets, func(wallet *models.HotWallet) (*big.Int, error) {
+		gasLimit, err := adapter.EstimateTransferGas(ctx, wallet.Address, withdrawal.ToAddress, amount)
+		if err != nil {
+			return nil, err
+		}
+		gasLimits[wallet.Address] = gasLimit
+		fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+		return fee.Add(fee, amount), nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to select hot wallet: %w", err)
+	}
 
-	// Estimate fee (21000 gas for simple transfer)
-	gasLimit := big.NewInt(21000)
-	fee := new(big.Int).Mul(gasPrice, gasLimit)
-
-	// Check if balance is sufficient
-	totalNeeded := new(big.Int).Add(amount, fee)
-	if balance.Cmp(totalNeeded) < 0 {
-		return fmt.Errorf("insufficient balance: have %s, need %s", balance.String(), totalNeeded.String())
+	// Wallet is locked from nonce lookup to broadcast, so concurrent sends from it get distinct nonces
+	err = s.storage.WithHotWalletLock(ctx, withdrawal.Chain, wallet.Address, func() error {
+		return s.signAndSend(ctx, adapter, withdrawal, wallet, amount, gasPrice, gasLimits[wallet.Address])
+	})
+	if err != nil {
+		return err
 	}
+	return s.markSent(withdrawal)
+}
 
-	// Decrypt private key
-	privateKey, err := s.decryptKey(wallet.EncryptedKey)
+// signAndSend builds and signs withdrawal tx from wallet, saves it and broadcasts it.
+// Gas limit is the one wallet was selected with, so its balance covers the fee.
+func (s *WithdrawalService) signAndSend(ctx context.Context, adapter adapters.BlockchainAdapter, withdrawal *models.Withdrawal, wallet *models.HotWallet, amount, gasPrice *big.Int, gasLimit uint64) error {
+	unsigned, err := adapter.BuildTransaction(ctx, wallet.Address, withdrawal.ToAddress, amount)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt key: %w", err)
+		return fmt.Errorf("failed to build transaction: %w", err)
 	}
+	// Gas price follows priority instead of node suggestion
+	unsigned.GasPrice = gasPrice.String()
+	unsigned.Gas = gasLimit
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(unsigned.Gas))
 
-	// Send transaction
-	txHash, err := adapter.SendTransaction(ctx, wallet.Address, withdrawal.ToAddress, amount, privateKey)
+	// Sign transaction, key is decrypted only for signing
+	signed, err := adapter.SignTransaction(ctx, unsigned, s.keys.KeyFunc(wallet.EncryptedKey))
 	if err != nil {
+		return fmt.Errorf("failed to sign transaction: %w", err)
+	}
+
+	// Signed tx is saved before broadcast, whoever recovers the lease rebroadcasts it
+	// instead of signing second transaction
+	withdrawal.FromAddress = wallet.Address
+	withdrawal.TxHash = signed.Hash
+	withdrawal.RawTx = signed.RawTx
+	withdrawal.Fee = fee.String()
+	if err := s.storage.UpdateClaimedWithdrawal(withdrawal); err != nil {
+		return fmt.Errorf("failed to save signed transaction: %w", err)
+	}
+
+	if _, err := adapter.SendRawTransaction(ctx, signed.RawTx); err != nil {
+		if errors.Is(err, adapters.ErrNonceTooLow) || errors.Is(err, adapters.ErrInsufficientFunds) {
+			// Nonce was taken by another tx or wallet balance dropped before ours was accepted,
+			// nothing was sent, withdrawal goes back to pending and is signed again
+			clearSignedTx(withdrawal)
+			return fmt.Errorf("transaction rejected: %w", err)
+		}
 		return fmt.Errorf("failed to send transaction: %w", err)
 	}
+	return nil
+}
+
+// clearSignedTx drops signed tx that can never be mined, withdrawal is signed again
+func clearSignedTx(withdrawal *models.Withdrawal) {
+	withdrawal.TxHash = ""
+	withdrawal.RawTx = ""
+	withdrawal.FromAddress = ""
+}
+
+// recoverWithdrawal finishes withdrawal whose tx was signed under expired lease.
+// Tx found on chain or in mempool was sent, unknown tx is rebroadcast.
+func (s *WithdrawalService) recoverWithdrawal(ctx context.Context, adapter adapters.BlockchainAdapter, withdrawal *models.Withdrawal) error {
+	_, err := adapter.GetTransactionStatus(ctx, withdrawal.TxHash)
+	if err == nil {
+		fmt.Printf("Recovered withdrawal already broadcast: id=%d, tx_hash=%s\n", withdrawal.ID, withdrawal.TxHash)
+		return s.markSent(withdrawal)
+	}
+	if !errors.Is(err, adapters.ErrTransactionNotFound) {
+		return fmt.Errorf("failed to get transaction status: %w", err)
+	}
 
-	// Update withdrawal
-	withdrawal.TxHash = txHash
+	if _, err := adapter.SendRawTransaction(ctx, withdrawal.RawTx); err != nil {
+		if !errors.Is(err, adapters.ErrNonceTooLow) {
+			return fmt.Errorf("failed to rebroadcast transaction: %w", err)
+		}
+		// Nonce is used, either by our tx mined meanwhile or by another one
+		if _, statusErr := adapter.GetTransactionStatus(ctx, withdrawal.TxHash); statusErr == nil {
+			fmt.Printf("Recovered withdrawal already mined: id=%d, tx_hash=%s\n", withdrawal.ID, withdrawal.TxHash)
+			return s.markSent(withdrawal)
+		} else if !errors.Is(statusErr, adapters.ErrTransactionNotFound) {
+			return fmt.Errorf("failed to get transaction status: %w", statusErr)
+		}
+		// Our tx wasn't mined and its nonce is gone, so it can never be, withdrawal is signed again
+		clearSignedTx(withdrawal)
+		return fmt.Errorf("nonce used by another transaction, signing again: %w", err)
+	}
+
+	fmt.Printf("Recovered withdrawal rebroadcast: id=%d, tx_hash=%s\n", withdrawal.ID, withdrawal.TxHash)
+	return s.markSent(withdrawal)
+}
+
+func (s *WithdrawalService) markSent(withdrawal *models.Withdrawal) error {
 	withdrawal.Status = models.WithdrawalStatusSent
-	withdrawal.Fee = fee.String()
+	withdrawal.LeaseExpiresAt = nil
+	withdrawal.NextAttemptAt = nil
 	now := time.Now()
 	withdrawal.SentAt = &now
 
-	if err := s.storage.UpdateWithdrawal(withdrawal); err != nil {
+	if err := s.storage.UpdateClaimedWithdrawal(withdrawal); err != nil {
 		return fmt.Errorf("failed to update withdrawal: %w", err)
 	}
 
-	fmt.Printf("Withdrawal sent: chain=%s, order_id=%s, tx_hash=%s\n", withdrawal.Chain, withdrawal.OrderID, txHash)
+	s.addEvent(withdrawal, models.WithdrawalEventSent, withdrawal.TxHash)
+	fmt.Printf("Withdrawal sent: chain=%s, order_id=%s, tx_hash=%s\n", withdrawal.Chain, withdrawal.OrderID, withdrawal.TxHash)
+	return nil
+}
+
+// deferWithdrawal puts withdrawal back to pending until next check, it doesn't count as failed attempt
+func (s *WithdrawalService) deferWithdrawal(withdrawal *models.Withdrawal, reason string) error {
+	next := time.Now().Add(lowPriorityRecheck)
+	withdrawal.Status = models.WithdrawalStatusPending
+	withdrawal.LeaseExpiresAt = nil
+	withdrawal.NextAttemptAt = &next
+	withdrawal.LastError = reason
+
+	if err := s.storage.UpdateClaimedWithdrawal(withdrawal); err != nil {
+		return fmt.Errorf("failed to defer withdrawal: %w", err)
+	}
 	return nil
 }
 
-// CreateWithdrawal creates new withdrawal request
-func (s *WithdrawalService) CreateWithdrawal(ctx context.Context, chain models.Chain, orderID, toAddress, amount string) (*models.Withdrawal, error) {
-	wallet, err := s.storage.GetHotWallet(chain)
+// handleFailure fails withdrawal on permanent error or after withdrawalMaxAttempts, otherwise schedules
+// retry with backoff. Withdrawal with signed tx stays processing, it's recovered (checked on chain) once
+// retry is due. It isn't failed for attempts, its tx may still be mined.
+func (s *WithdrawalService) handleFailure(withdrawal *models.Withdrawal, cause error) {
+	if errors.Is(cause, storage.ErrLeaseLost) {
+		fmt.Printf("Withdrawal %d was taken over by another instance: %v\n", withdrawal.ID, cause)
+		return
+	}
+
+	withdrawal.Attempts++
+	withdrawal.LastError = cause.Error()
+	if !isPermanent(cause) && withdrawal.RawTx == "" && withdrawal.Attempts >= withdrawalMaxAttempts {
+		cause = permanent(fmt.Errorf("gave up after %d attempts: %w", withdrawal.Attempts, cause))
+	}
+
+	eventType := models.WithdrawalEventRetry
+	if isPermanent(cause) {
+		eventType = models.WithdrawalEventFailed
+		withdrawal.Status = models.WithdrawalStatusFailed
+		withdrawal.FailureReason = cause.Error()
+		withdrawal.LeaseExpiresAt = nil
+		withdrawal.NextAttemptAt = nil
+	} else {
+		next := time.Now().Add(retryDelay(withdrawal.Attempts))
+		withdrawal.NextAttemptAt = &next
+		if withdrawal.RawTx == "" {
+			withdrawal.Status = models.WithdrawalStatusPending
+			withdrawal.LeaseExpiresAt = nil
+		} else {
+			withdrawal.LeaseExpiresAt = &next
+		}
+	}
+
+	if err := s.storage.UpdateClaimedWithdrawal(withdrawal); err != nil {
+		fmt.Printf("Error processing withdrawal %d: %v, failed to save it: %v\n", withdrawal.ID, cause, err)
+		return
+	}
+	s.addEvent(withdrawal, eventType, cause.Error())
+
+	if eventType == models.WithdrawalEventFailed {
+		// TODO: Send webhook/event about failed withdrawal
+		fmt.Printf("Withdrawal failed: chain=%s, order_id=%s, reason=%s\n", withdrawal.Chain, withdrawal.OrderID, withdrawal.FailureReason)
+	} else {
+		fmt.Printf("Error processing withdrawal %d (attempt %d, next at %s): %v\n", withdrawal.ID, withdrawal.Attempts, withdrawal.NextAttemptAt.Format(time.RFC3339), cause)
+	}
+}
+
+// CheckSentWithdrawals confirms mined withdrawals once their block is confirmed by chain policy,
+// reverted ones fail. Fee of mined withdrawal is set to network fee actually paid and reconciled
+// against quote. Tx unknown to node is rebroadcast, see checkDropped.
+func (s *WithdrawalService) CheckSentWithdrawals(ctx context.Context, chain models.Chain) error {
+	adapter, ok := s.adapters[chain]
+	if !ok {
+		return fmt.Errorf("chain %s not supported", chain)
+	}
+
+	withdrawals, err := s.storage.GetSentWithdrawals(chain)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get hot wallet: %w", err)
+		return fmt.Errorf("failed to get sent withdrawals: %w", err)
 	}
-	if wallet == nil {
-		return nil, fmt.Errorf("hot wallet not found for chain %s", chain)
+	if len(withdrawals) == 0 {
+		return nil
 	}
 
-	withdrawal := &models.Withdrawal{
-		Chain:       chain,
-		OrderID:     orderID,
-		FromAddress: wallet.Address,
-		ToAddress:   toAddress,
-		Amount:      amount,
-		Fee:         "0", // Will be calculated when sending
-		Status:      models.WithdrawalStatusPending,
+	latestBlock, err := adapter.GetLatestBlock(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+	confirmed, err := confirmedHead(ctx, adapter, s.policy.confirmation(chain), latestBlock)
+	if err != nil {
+		return fmt.Errorf("failed to get confirmed block: %w", err)
 	}
 
-	if err := s.storage.CreateWithdrawal(withdrawal); err != nil {
-		return nil, fmt.Errorf("failed to create withdrawal: %w", err)
+	for _, withdrawal := range withdrawals {
+		status, err := adapter.GetTransactionStatus(ctx, withdrawal.TxHash)
+		if errors.Is(err, adapters.ErrTransactionNotFound) {
+			s.checkDropped(ctx, adapter, withdrawal)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to get status of withdrawal %d: %v\n", withdrawal.ID, err)
+			continue
+		}
+		if status.Status == "pending" {
+			continue
+		}
+
+		txHash := withdrawal.TxHash
+		withdrawal.BlockNumber = status.BlockNumber
+		withdrawal.Confirmations = status.Confirmations
+		if status.BlockNumber > confirmed {
+			// Mined, but block may still be reorged out
+			if _, err := s.storage.UpdateSentWithdrawal(withdrawal, txHash); err != nil {
+				fmt.Printf("Warning: failed to update withdrawal %d: %v\n", withdrawal.ID, err)
+			}
+			continue
+		}
+
+		// Gas is paid by reverted tx as well
+		var reconciliation string
+		if status.Fee != nil {
+			reconciliation = reconcileFee(withdrawal, status.Fee)
+		}
+		eventType := models.WithdrawalEventConfirmed
+		if status.Success {
+			withdrawal.Status = models.WithdrawalStatusConfirmed
+			now := time.Now()
+			withdrawal.ConfirmedAt = &now
+		} else {
+			eventType = models.WithdrawalEventFailed
+			withdrawal.Status = models.WithdrawalStatusFailed
+			withdrawal.FailureReason = "transaction reverted"
+		}
+		updated, err := s.storage.UpdateSentWithdrawal(withdrawal, txHash)
+		if err != nil {
+			fmt.Printf("Warning: failed to update withdrawal %d: %v\n", withdrawal.ID, err)
+			continue
+		}
+		if !updated {
+			// Another instance finished it
+			continue
+		}
+		s.addEvent(withdrawal, eventType, withdrawal.FailureReason)
+		if reconciliation != "" {
+			s.addEvent(withdrawal, models.WithdrawalEventFeeReconciled, reconciliation)
+		}
+
+		// TODO: Send webhook/event about withdrawal result
+		fmt.Printf("Withdrawal %s: chain=%s, order_id=%s, tx_hash=%s\n", withdrawal.Status, withdrawal.Chain, withdrawal.OrderID, withdrawal.TxHash)
+	}
+	return nil
+}
+
+// checkDropped handles sent withdrawal whose tx node doesn't know (dropped from mempool, reorged out
+// or not propagated yet). After withdrawalRebroadcastAfter saved tx is rebroadcast. If its nonce was
+// used by another tx, ours can never be mined and withdrawal goes back to pending to be signed again.
+// Tx that still isn't mined after withdrawalDropTimeout fails for manual review, its nonce is unused
+// and it may still be mined, so it's not signed again automatically.
+func (s *WithdrawalService) checkDropped(ctx context.Context, adapter adapters.BlockchainAdapter, withdrawal *models.Withdrawal) {
+	if withdrawal.SentAt == nil || time.Since(*withdrawal.SentAt) < withdrawalRebroadcastAfter {
+		return
+	}
+	txHash := withdrawal.TxHash
+
+	if time.Since(*withdrawal.SentAt) >= withdrawalDropTimeout {
+		withdrawal.Status = models.WithdrawalStatusFailed
+		withdrawal.FailureReason = fmt.Sprintf("transaction not mined within %s, its nonce is unused, review before retrying", withdrawalDropTimeout)
+		s.finishDropped(withdrawal, txHash, models.WithdrawalEventFailed, withdrawal.FailureReason)
+		return
+	}
+
+	_, err := adapter.SendRawTransaction(ctx, withdrawal.RawTx)
+	if err == nil {
+		fmt.Printf("Withdrawal tx not found, rebroadcast: id=%d, tx_hash=%s\n", withdrawal.ID, txHash)
+		return
+	}
+	if !errors.Is(err, adapters.ErrNonceTooLow) {
+		fmt.Printf("Warning: failed to rebroadcast withdrawal %d: %v\n", withdrawal.ID, err)
+		return
+	}
+	// Our tx may have been mined meanwhile
+	if _, statusErr := adapter.GetTransactionStatus(ctx, txHash); !errors.Is(statusErr, adapters.ErrTransactionNotFound) {
+		return
+	}
+
+	withdrawal.Status = models.WithdrawalStatusPending
+	withdrawal.SentAt = nil
+	withdrawal.LastError = fmt.Sprintf("transaction %s dropped, nonce used by another transaction", txHash)
+	clearSignedTx(withdrawal)
+	s.finishDropped(withdrawal, txHash, models.WithdrawalEventRetry, withdrawal.LastError)
+}
+
+func (s *WithdrawalService) finishDropped(withdrawal *models.Withdrawal, txHash string, eventType models.WithdrawalEventType, message string) {
+	updated, err := s.storage.UpdateSentWithdrawal(withdrawal, txHash)
+	if err != nil {
+		fmt.Printf("Warning: failed to update withdrawal %d: %v\n", withdrawal.ID, err)
+		return
+	}
+	if !updated {
+		return
+	}
+	s.addEvent(withdrawal, eventType, message)
+	fmt.Printf("Dropped withdrawal %s: chain=%s, order_id=%s, %s\n", withdrawal.Status, withdrawal.Chain, withdrawal.OrderID, message)
+}
+
+func (s *WithdrawalService) addEvent(withdrawal *models.Withdrawal, eventType models.WithdrawalEventType, message string) {
+	event := &models.WithdrawalEvent{
+		WithdrawalID: withdrawal.ID,
+		Type:         eventType,
+		Message:      message,
+	}
+	if err := s.storage.CreateWithdrawalEvent(event); err != nil {
+		fmt.Printf("Warning: failed to save withdrawal %d event: %v\n", withdrawal.ID, err)
+	}
+}
+
+// CancelWithdrawal cancels withdrawal created by mistake. Only pending withdrawals and ones awaiting
+// approval can be cancelled, once claimed for sending it's too late. Limit usage is released with it.
+func (s *WithdrawalService) CancelWithdrawal(ctx context.Context, id int64, cancelledBy, reason string) (*models.Withdrawal, error) {
+	if cancelledBy == "" {
+		return nil, fmt.Errorf("canceller is required")
+	}
+
+	message := "cancelled by " + cancelledBy
+	if reason != "" {
+		message += ": " + reason
+	}
+	withdrawal, err := s.storage.CancelWithdrawal(id, message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel withdrawal: %w", err)
+	}
+	if withdrawal == nil {
+		return nil, fmt.Errorf("withdrawal %d not found", id)
 	}
 
+	s.addEvent(withdrawal, models.WithdrawalEventCancelled, message)
+	// TODO: Send webhook/event about cancelled withdrawal
+	fmt.Printf("Withdrawal cancelled: chain=%s, order_id=%s, %s\n", withdrawal.Chain, withdrawal.OrderID, message)
+
+	return s.GetWithdrawal(ctx, withdrawal.ID)
+}
+
+// GetWithdrawal returns withdrawal by id with its history
+func (s *WithdrawalService) GetWithdrawal(ctx context.Context, id int64) (*models.Withdrawal, error) {
+	withdrawal, err := s.storage.GetWithdrawalByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal: %w", err)
+	}
+	if withdrawal == nil {
+		return nil, fmt.Errorf("withdrawal %d not found", id)
+	}
+
+	withdrawal.Events, err = s.storage.GetWithdrawalEvents(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal events: %w", err)
+	}
+	withdrawal.Approvals, err = s.storage.GetWithdrawalApprovals(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal approvals: %w", err)
+	}
 	return withdrawal, nil
 }
 
-// Simple encryption/decryption (TODO: use proper key management)
-func (s *WithdrawalService) encryptKey(key string) (string, error) {
-	block, err := aes.NewCipher(s.encKey)
+// validateDestination returns canonical destination address and whether it's contract.
+// Our own hot wallets are rejected, contracts too if policy says so.
+func (s *WithdrawalService) validateDestination(ctx context.Context, adapter adapters.BlockchainAdapter, chain models.Chain, address string) (string, bool, error) {
+	address, err := adapter.ValidateAddress(address)
 	if err != nil {
-		return "", err
+		return "", false, fmt.Errorf("%w: %v", ErrInvalidDestination, err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	wallets, err := s.storage.ListHotWallets(chain)
 	if err != nil {
-		return "", err
+		return "", false, fmt.Errorf("failed to get hot wallets: %w", err)
+	}
+	for _, wallet := range wallets {
+		if strings.EqualFold(wallet.Address, address) {
+			return "", false, fmt.Errorf("%w: %s is our hot wallet", ErrInvalidDestination, address)
+		}
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+	isContract, err := adapter.IsContract(ctx, address)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check destination: %w", err)
 	}
+	if isContract && s.policy.RejectContracts {
+		return "", false, fmt.Errorf("%w: %s is contract", ErrInvalidDestination, address)
+	}
+	return address, isContract, nil
+}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(key), nil)
-	return hex.EncodeToString(ciphertext), nil
+// WithdrawalRequest is new withdrawal, amount is in base units
+type WithdrawalRequest struct {
+	Chain      models.Chain
+	MerchantID string
+	UserID     string
+	OrderID    string
+	ToAddress  string
+	Amount     string
+	// IdempotencyKey defaults to OrderID
+	IdempotencyKey string
+	// NotBefore schedules withdrawal, nil to send it right away
+	NotBefore *time.Time
+	// Priority is low, normal (default) or urgent
+	Priority models.WithdrawalPriority
+	// internal is set for withdrawals service creates itself, only they may use internal keys
+	internal bool
 }
 
-func (s *WithdrawalService) decryptKey(encryptedHex string) (string, error) {
-	ciphertext, err := hex.DecodeString(encryptedHex)
+// internalKeyPrefix starts idempotency keys of internal withdrawals (deposit refunds),
+// so client order ids and keys never collide with them
+const internalKeyPrefix = "internal:"
+
+// CreateWithdrawal creates new withdrawal request. Idempotency key defaults to order id;
+// repeated request returns original withdrawal with created=false before any other checks.
+// Withdrawal matching approval policy waits in awaiting_approval instead of pending.
+// Fees are quoted now under merchant's fee mode, deducted mode sends amount less fees.
+func (s *WithdrawalService) CreateWithdrawal(ctx context.Context, req WithdrawalRequest) (*models.Withdrawal, bool, error) {
+	chain := req.Chain
+	if req.OrderID == "" {
+		return nil, false, fmt.Errorf("order id is required")
+	}
+	value, ok := parseAmount(req.Amount)
+	if !ok || value.Sign() <= 0 {
+		return nil, false, fmt.Errorf("invalid amount: %s", req.Amount)
+	}
+	idempotencyKey := req.IdempotencyKey
+	if idempotencyKey == "" {
+		idempotencyKey = req.OrderID
+	}
+	if strings.HasPrefix(idempotencyKey, internalKeyPrefix) && !req.internal {
+		return nil, false, fmt.Errorf("idempotency key can't start with %q", internalKeyPrefix)
+	}
+
+	// Replay gets original withdrawal even if destination, wallets or fees changed since
+	existing, err := s.storage.GetWithdrawalByIdempotencyKey(req.MerchantID, idempotencyKey)
 	if err != nil {
-		return "", err
+		return nil, false, fmt.Errorf("failed to get withdrawal: %w", err)
+	}
+	if existing != nil {
+		if existing.Chain != chain || existing.UserID != req.UserID || existing.OrderID != req.OrderID ||
+			!strings.EqualFold(existing.ToAddress, req.ToAddress) || existing.Amount != value.String() {
+			return nil, false, storage.ErrIdempotencyConflict
+		}
+		return existing, false, nil
 	}
 
-	block, err := aes.NewCipher(s.encKey)
+	priority, err := parsePriority(req.Priority)
 	if err != nil {
-		return "", err
+		return nil, false, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	adapter, ok := s.adapters[chain]
+	if !ok {
+		return nil, false, fmt.Errorf("chain %s not supported", chain)
+	}
+	toAddress, toContract, err := s.validateDestination(ctx, adapter, chain, req.ToAddress)
 	if err != nil {
-		return "", err
+		return nil, false, err
+	}
+
+	wallets, err := s.storage.GetActiveHotWallets(chain)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get hot wallets: %w", err)
+	}
+	if len(wallets) == 0 {
+		return nil, false, fmt.Errorf("hot wallet not found for chain %s", chain)
 	}
 
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
+	// Client may send any offset, withdrawal keeps UTC
+	var notBefore *time.Time
+	if req.NotBefore != nil {
+		utc := req.NotBefore.UTC()
+		notBefore = &utc
 	}
 
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	quote, err := s.quote(ctx, adapter, chain, req.MerchantID, value, toContract, priority)
 	if err != nil {
-		return "", err
+		return nil, false, err
 	}
 
-	return string(plaintext), nil
-}
+	withdrawal := &models.Withdrawal{
+		Chain:          chain,
+		MerchantID:     req.MerchantID,
+		UserID:         req.UserID,
+		OrderID:        req.OrderID,
+		IdempotencyKey: idempotencyKey,
+		FromAddress:    "", // Hot wallet is selected when sending
+		ToAddress:      toAddress,
+		ToContract:     toContract,
+		Asset:          adapters.NativeAsset,
+		Amount:         value.String(),
+		Fee:            "0", // Will be calculated when sending
+		FeeMode:        quote.FeeMode,
+		QuotedFee:      quote.NetworkFee,
+		ServiceFee:     quote.ServiceFee,
+		ReceiveAmount:  quote.ReceiveAmount,
+		NotBefore:      notBefore,
+		Priority:       priority,
+		Status:         models.WithdrawalStatusPending,
+	}
+	if err := s.checkDestination(withdrawal); err != nil {
+		return nil, false, err
+	}
+	if reason := s.policy.Approvals.match(withdrawal, value); reason != "" {
+		withdrawal.Status = models.WithdrawalStatusAwaitingApproval
+		withdrawal.RequiredApprovals = s.policy.Approvals.RequiredApprovals
+		withdrawal.ApprovalReason = reason
+	}
 
+	created, err := s.storage.CreateWithdrawal(withdrawal)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create withdrawal: %w", err)
+	}
+	if created && withdrawal.Status == models.WithdrawalStatusAwaitingApproval {
+		s.addEvent(withdrawal, models.WithdrawalEventApprovalRequired, withdrawal.ApprovalReason)
+		// TODO: notify approvers
+		fmt.Printf("Withdrawal awaiting approval: chain=%s, order_id=%s, reason=%s\n", chain, withdrawal.OrderID, withdrawal.ApprovalReason)
+	}
+
+	return withdrawal, created, nil
+}
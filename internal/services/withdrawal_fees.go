@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// ErrAmountBelowFees is returned when fees deducted from withdrawal amount leave nothing to send
+var ErrAmountBelowFees = errors.New("amount doesn't cover fees")
+
+// ServiceFee is our fee for withdrawal of chain native coin: Flat plus BPS of amount
+type ServiceFee struct {
+	Flat *big.Int
+	BPS  int
+}
+
+// NewServiceFee parses service fee, flat is decimal wei string, empty for none
+func NewServiceFee(flat string, bps int) (ServiceFee, error) {
+	fee := ServiceFee{Flat: new(big.Int), BPS: bps}
+	if flat != "" {
+		value, ok := new(big.Int).SetString(flat, 10)
+		if !ok || value.Sign() < 0 {
+			return ServiceFee{}, fmt.Errorf("invalid service fee: %q", flat)
+		}
+		fee.Flat = value
+	}
+	if bps < 0 || bps > 10000 {
+		return ServiceFee{}, fmt.Errorf("invalid service fee bps: %d", bps)
+	}
+	return fee, nil
+}
+
+// amount returns service fee for withdrawal amount
+func (f ServiceFee) amount(value *big.Int) *big.Int {
+	fee := new(big.Int).Mul(value, big.NewInt(int64(f.BPS)))
+	fee.Div(fee, big.NewInt(10000))
+	if f.Flat != nil {
+		fee.Add(fee, f.Flat)
+	}
+	return fee
+}
+
+// QuoteWithdrawal estimates network fee at current gas price and our service fee, and what recipient
+// gets and merchant pays under merchant's fee mode. Destination is optional, contract needs more gas.
+// Urgent priority pays increased gas price.
+func (s *WithdrawalService) QuoteWithdrawal(ctx context.Context, chain models.Chain, merchantID, asset, toAddress, amount string, priority models.WithdrawalPriority) (*models.WithdrawalQuote, error) {
+	adapter, ok := s.adapters[chain]
+	if !ok {
+		return nil, fmt.Errorf("chain %s not supported", chain)
+	}
+	asset, err := adapters.NormalizeAsset(asset)
+	if err != nil {
+		return nil, err
+	}
+	// TODO: token withdrawals, only native coin is sent for now
+	if asset != adapters.NativeAsset {
+		return nil, fmt.Errorf("asset %s can't be withdrawn, only native coin is supported", asset)
+	}
+	value, ok := parseAmount(amount)
+	if !ok || value.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid amount: %s", amount)
+	}
+	priority, err = parsePriority(priority)
+	if err != nil {
+		return nil, err
+	}
+
+	toContract := false
+	if toAddress != "" {
+		if _, toContract, err = s.validateDestination(ctx, adapter, chain, toAddress); err != nil {
+			return nil, err
+		}
+	}
+	return s.quote(ctx, adapter, chain, merchantID, value, toContract, priority)
+}
+
+func (s *WithdrawalService) quote(ctx context.Context, adapter adapters.BlockchainAdapter, chain models.Chain, merchantID string, value *big.Int, toContract bool, priority models.WithdrawalPriority) (*models.WithdrawalQuote, error) {
+	settings, err := s.storage.GetMerchantFeeSettings(merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merchant fee settings: %w", err)
+	}
+
+	gasPrice, err := adapter.GetGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gas price: %w", err)
+	}
+	gasPrice = s.policy.Priorities.gasPrice(priority, gasPrice)
+	gasLimit := uint64(21000)
+	if toContract {
+		gasLimit = contractGasReserve
+	}
+	networkFee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+	serviceFee := s.policy.ServiceFees[chain].amount(value)
+	fees := new(big.Int).Add(networkFee, serviceFee)
+
+	receive, total := value, new(big.Int).Add(value, fees)
+	if settings.FeeMode == models.FeeModeDeducted {
+		receive, total = new(big.Int).Sub(value, fees), value
+		if receive.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: amount %s, fees %s", ErrAmountBelowFees, value, fees)
+		}
+	}
+
+	return &models.WithdrawalQuote{
+		Chain:         chain,
+		Asset:         adapters.NativeAsset,
+		MerchantID:    merchantID,
+		FeeMode:       settings.FeeMode,
+		Priority:      priority,
+		Amount:        value.String(),
+		GasPrice:      gasPrice.String(),
+		GasLimit:      gasLimit,
+		NetworkFee:    networkFee.String(),
+		ServiceFee:    serviceFee.String(),
+		ReceiveAmount: receive.String(),
+		TotalAmount:   total.String(),
+	}, nil
+}
+
+func (s *WithdrawalService) GetMerchantFeeSettings(ctx context.Context, merchantID string) (*models.MerchantFeeSettings, error) {
+	settings, err := s.storage.GetMerchantFeeSettings(merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merchant fee settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SetMerchantFeeMode sets who pays fees of merchant's withdrawals, existing withdrawals keep their mode
+func (s *WithdrawalService) SetMerchantFeeMode(ctx context.Context, merchantID string, mode models.FeeMode) (*models.MerchantFeeSettings, error) {
+	if merchantID == "" {
+		return nil, fmt.Errorf("merchant id is required")
+	}
+	switch mode {
+	case models.FeeModeOnTop, models.FeeModeDeducted:
+	default:
+		return nil, fmt.Errorf("unknown fee mode: %s", mode)
+	}
+
+	settings := &models.MerchantFeeSettings{
+		MerchantID: merchantID,
+		FeeMode:    mode,
+	}
+	if err := s.storage.SetMerchantFeeSettings(settings); err != nil {
+		return nil, fmt.Errorf("failed to save merchant fee settings: %w", err)
+	}
+	return settings, nil
+}
+
+// reconcileFee replaces estimated fee with fee actually paid, returns its difference from quote for event
+func reconcileFee(withdrawal *models.Withdrawal, actual *big.Int) string {
+	quoted, ok := parseAmount(withdrawal.QuotedFee)
+	if !ok {
+		quoted = new(big.Int)
+	}
+	withdrawal.Fee = actual.String()
+	diff := new(big.Int).Sub(actual, quoted)
+	return fmt.Sprintf("network fee %s, quoted %s, difference %s", actual, quoted, diff)
+}
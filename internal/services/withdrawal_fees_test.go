@@ -0,0 +1,31 @@
+package services
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestServiceFeeAmount(t *testing.T) {
+	tests := []struct {
+		name  string
+		fee   ServiceFee
+		value int64
+		want  int64
+	}{
+		{name: "free", fee: ServiceFee{Flat: new(big.Int)}, value: 10000, want: 0},
+		{name: "zero value fee", fee: ServiceFee{}, value: 10000, want: 0},
+		{name: "flat", fee: ServiceFee{Flat: big.NewInt(1000)}, value: 10000, want: 1000},
+		{name: "bps", fee: ServiceFee{BPS: 50}, value: 10000, want: 50},
+		{name: "flat and bps", fee: ServiceFee{Flat: big.NewInt(1000), BPS: 100}, value: 12345, want: 1123},
+		{name: "bps rounds down", fee: ServiceFee{BPS: 1}, value: 9999, want: 0},
+		{name: "whole amount", fee: ServiceFee{BPS: 10000}, value: 777, want: 777},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fee.amount(big.NewInt(tt.value)); got.Cmp(big.NewInt(tt.want)) != 0 {
+				t.Fatalf("got %s, want %d", got, tt.want)
+			}
+		})
+	}
+}
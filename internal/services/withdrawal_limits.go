@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/adapters"
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// SetLimit creates or updates limit of chain asset over rolling window, amounts of different
+// assets aren't comparable, so there is no limit across chains or assets.
+// userID is "" for all withdrawals of chain asset together, "*" for every user separately, otherwise single user.
+func (s *WithdrawalService) SetLimit(ctx context.Context, chain models.Chain, asset, userID string, window time.Duration, maxAmount string) (*models.WithdrawalLimit, error) {
+	if _, ok := s.adapters[chain]; !ok {
+		return nil, fmt.Errorf("chain %s not supported", chain)
+	}
+	asset, err := adapters.NormalizeAsset(asset)
+	if err != nil {
+		return nil, err
+	}
+	if window < time.Minute {
+		return nil, fmt.Errorf("invalid window %s, must be at least 1m", window)
+	}
+	// Zero max amount blocks withdrawals in scope
+	value, ok := parseAmount(maxAmount)
+	if !ok || maxAmount == "" {
+		return nil, fmt.Errorf("invalid max amount: %s", maxAmount)
+	}
+
+	limit := &models.WithdrawalLimit{
+		Chain:         chain,
+		Asset:         asset,
+		UserID:        userID,
+		WindowSeconds: int64(window.Seconds()),
+		MaxAmount:     value.String(),
+	}
+	if err := s.storage.CreateWithdrawalLimit(limit); err != nil {
+		return nil, fmt.Errorf("failed to save withdrawal limit: %w", err)
+	}
+	return limit, nil
+}
+
+// ListLimits returns withdrawal limits with current usage, per user limits show usage of userID
+func (s *WithdrawalService) ListLimits(ctx context.Context, userID string) ([]*models.WithdrawalLimit, error) {
+	limits, err := s.storage.ListWithdrawalLimits(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list withdrawal limits: %w", err)
+	}
+	return limits, nil
+}
+
+func (s *WithdrawalService) DeleteLimit(ctx context.Context, id int64) error {
+	deleted, err := s.storage.DeleteWithdrawalLimit(id)
+	if err != nil {
+		return fmt.Errorf("failed to delete withdrawal limit: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("withdrawal limit %d not found", id)
+	}
+	return nil
+}
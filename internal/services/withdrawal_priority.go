@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// Low priority withdrawal waiting for cheap gas checks gas price again after this delay
+const lowPriorityRecheck = time.Minute
+
+// PriorityPolicy maps withdrawal priority to gas price
+type PriorityPolicy struct {
+	// UrgentGasPricePercent is gas price of urgent withdrawals in percent of suggested one
+	UrgentGasPricePercent int
+	// LowMaxGasPrices - low priority withdrawals wait while gas price is above it, chains without one don't wait
+	LowMaxGasPrices map[models.Chain]*big.Int
+	// LowMaxDelay is how long low priority withdrawal waits for cheap gas at most, then it's sent anyway
+	LowMaxDelay time.Duration
+}
+
+// NewPriorityPolicy parses policy, max gas prices are decimal wei strings, empty one disables waiting
+func NewPriorityPolicy(urgentGasPricePercent int, lowMaxGasPrices map[models.Chain]string, lowMaxDelay time.Duration) (*PriorityPolicy, error) {
+	if urgentGasPricePercent < 100 {
+		return nil, fmt.Errorf("urgent gas price percent must be at least 100, got %d", urgentGasPricePercent)
+	}
+
+	policy := &PriorityPolicy{
+		UrgentGasPricePercent: urgentGasPricePercent,
+		LowMaxGasPrices:       make(map[models.Chain]*big.Int),
+		LowMaxDelay:           lowMaxDelay,
+	}
+	for chain, price := range lowMaxGasPrices {
+		if price == "" {
+			continue
+		}
+		value, ok := new(big.Int).SetString(price, 10)
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid low priority max gas price for %s: %q", chain, price)
+		}
+		policy.LowMaxGasPrices[chain] = value
+	}
+	return policy, nil
+}
+
+// parsePriority validates withdrawal priority, empty one is normal
+func parsePriority(priority models.WithdrawalPriority) (models.WithdrawalPriority, error) {
+	switch priority {
+	case "":
+		return models.WithdrawalPriorityNormal, nil
+	case models.WithdrawalPriorityLow, models.WithdrawalPriorityNormal, models.WithdrawalPriorityUrgent:
+		return priority, nil
+	}
+	return "", fmt.Errorf("unknown priority: %s", priority)
+}
+
+// gasPrice returns gas price withdrawal of priority is sent with. Low priority pays suggested
+// price like normal one, it only saves by waiting for cheap gas (see wait); a tx priced below
+// suggestion could get stuck and there's no fee bump yet.
+func (p *PriorityPolicy) gasPrice(priority models.WithdrawalPriority, suggested *big.Int) *big.Int {
+	if priority != models.WithdrawalPriorityUrgent {
+		return suggested
+	}
+	price := new(big.Int).Mul(suggested, big.NewInt(int64(p.UrgentGasPricePercent)))
+	return price.Div(price, big.NewInt(100))
+}
+
+// wait returns why low priority withdrawal should wait for cheaper gas, "" if it can be sent
+func (p *PriorityPolicy) wait(withdrawal *models.Withdrawal, gasPrice *big.Int) string {
+	if withdrawal.Priority != models.WithdrawalPriorityLow {
+		return ""
+	}
+	maxPrice, ok := p.LowMaxGasPrices[withdrawal.Chain]
+	if !ok || gasPrice.Cmp(maxPrice) <= 0 {
+		return ""
+	}
+
+	due := withdrawal.CreatedAt
+	if withdrawal.NotBefore != nil && withdrawal.NotBefore.After(due) {
+		due = *withdrawal.NotBefore
+	}
+	if time.Since(due) >= p.LowMaxDelay {
+		return ""
+	}
+	return fmt.Sprintf("waiting for gas price %s or lower, current %s", maxPrice, gasPrice)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+func TestPriorityPolicyWait(t *testing.T) {
+	policy, err := NewPriorityPolicy(150, map[models.Chain]string{models.ChainEthereum: "100"}, time.Hour)
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+	old := now.Add(-2 * time.Hour)
+
+	tests := []struct {
+		name      string
+		chain     models.Chain
+		priority  models.WithdrawalPriority
+		createdAt time.Time
+		notBefore *time.Time
+		gasPrice  int64
+		wait      bool
+	}{
+		{name: "normal priority", chain: models.ChainEthereum, priority: models.WithdrawalPriorityNormal, createdAt: recent, gasPrice: 1000},
+		{name: "urgent priority", chain: models.ChainEthereum, priority: models.WithdrawalPriorityUrgent, createdAt: recent, gasPrice: 1000},
+		{name: "chain without max", chain: models.ChainPolygon, priority: models.WithdrawalPriorityLow, createdAt: recent, gasPrice: 1000},
+		{name: "cheap gas", chain: models.ChainEthereum, priority: models.WithdrawalPriorityLow, createdAt: recent, gasPrice: 99},
+		{name: "gas at max", chain: models.ChainEthereum, priority: models.WithdrawalPriorityLow, createdAt: recent, gasPrice: 100},
+		{name: "expensive gas", chain: models.ChainEthereum, priority: models.WithdrawalPriorityLow, createdAt: recent, gasPrice: 101, wait: true},
+		{name: "waited too long", chain: models.ChainEthereum, priority: models.WithdrawalPriorityLow, createdAt: old, gasPrice: 101},
+		{name: "scheduled recently", chain: models.ChainEthereum, priority: models.WithdrawalPriorityLow, createdAt: old, notBefore: &recent, gasPrice: 101, wait: true},
+		{name: "scheduled long ago", chain: models.ChainEthereum, priority: models.WithdrawalPriorityLow, createdAt: old, notBefore: &old, gasPrice: 101},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withdrawal := &models.Withdrawal{
+				Chain:     tt.chain,
+				Priority:  tt.priority,
+				CreatedAt: tt.createdAt,
+				NotBefore: tt.notBefore,
+			}
+			reason := policy.wait(withdrawal, big.NewInt(tt.gasPrice))
+			if (reason != "") != tt.wait {
+				t.Fatalf("wait = %q, want waiting %v", reason, tt.wait)
+			}
+		})
+	}
+}
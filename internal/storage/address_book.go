@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+const withdrawalAddressColumns = `id, user_id, chain, address, label, created_at, usable_after`
+
+func scanWithdrawalAddress(row rowScanner) (*models.WithdrawalAddress, error) {
+	address := &models.WithdrawalAddress{}
+	err := row.Scan(
+		&address.ID,
+		&address.UserID,
+		&address.Chain,
+		&address.Address,
+		&address.Label,
+		&address.CreatedAt,
+		&address.UsableAfter,
+	)
+	return address, err
+}
+
+// CreateWithdrawalAddress adds address book entry. Already known address only gets new label,
+// its cooldown is kept.
+func (s *PostgresStorage) CreateWithdrawalAddress(address *models.WithdrawalAddress) error {
+	query := `
+		INSERT INTO withdrawal_addresses (user_id, chain, address, label, usable_after)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, chain, lower(address)) DO UPDATE SET label = EXCLUDED.label
+		RETURNING ` + withdrawalAddressColumns
+	created, err := scanWithdrawalAddress(s.db.QueryRow(
+		query,
+		address.UserID,
+		address.Chain,
+		address.Address,
+		address.Label,
+		address.UsableAfter,
+	))
+	if err != nil {
+		return err
+	}
+	*address = *created
+	return nil
+}
+
+// GetWithdrawalAddress returns user's address book entry, address is matched case-insensitively
+func (s *PostgresStorage) GetWithdrawalAddress(userID string, chain models.Chain, address string) (*models.WithdrawalAddress, error) {
+	query := `
+		SELECT ` + withdrawalAddressColumns + `
+		FROM withdrawal_addresses
+		WHERE user_id = $1 AND chain = $2 AND lower(address) = lower($3)
+	`
+	entry, err := scanWithdrawalAddress(s.db.QueryRow(query, userID, chain, address))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// ListWithdrawalAddresses returns user's address book, "" chain for all chains
+func (s *PostgresStorage) ListWithdrawalAddresses(userID string, chain models.Chain) ([]*models.WithdrawalAddress, error) {
+	query := `
+		SELECT ` + withdrawalAddressColumns + `
+		FROM withdrawal_addresses
+		WHERE user_id = $1 AND ($2 = '' OR chain::text = $2)
+		ORDER BY id
+	`
+	rows, err := s.db.Query(query, userID, chain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []*models.WithdrawalAddress
+	for rows.Next() {
+		address, err := scanWithdrawalAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+// DeleteWithdrawalAddress removes user's address book entry, returns false if it doesn't exist
+func (s *PostgresStorage) DeleteWithdrawalAddress(userID string, id int64) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM withdrawal_addresses WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// GetWithdrawalSettings returns user's settings, defaults if user has none
+func (s *PostgresStorage) GetWithdrawalSettings(userID string) (*models.WithdrawalSettings, error) {
+	settings := &models.WithdrawalSettings{UserID: userID}
+	query := `SELECT whitelist_only, whitelist_only_until, updated_at FROM withdrawal_user_settings WHERE user_id = $1`
+	err := s.db.QueryRow(query, userID).Scan(&settings.WhitelistOnly, &settings.WhitelistOnlyUntil, &settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	return settings, err
+}
+
+// SetWithdrawalSettings saves user's settings. Turning whitelist-only on takes effect immediately,
+// turning it off only after cooldown, whitelist_only_until is kept if it's already being turned off.
+func (s *PostgresStorage) SetWithdrawalSettings(settings *models.WithdrawalSettings, cooldown time.Duration) error {
+	query := `
+		INSERT INTO withdrawal_user_settings (user_id, whitelist_only)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET
+			whitelist_only = EXCLUDED.whitelist_only,
+			whitelist_only_until = CASE
+				WHEN EXCLUDED.whitelist_only THEN NULL
+				WHEN withdrawal_user_settings.whitelist_only THEN NOW() + $3 * INTERVAL '1 second'
+				ELSE withdrawal_user_settings.whitelist_only_until
+			END,
+			updated_at = NOW()
+		RETURNING whitelist_only_until, updated_at
+	`
+	return s.db.QueryRow(query, settings.UserID, settings.WhitelistOnly, int64(cooldown.Seconds())).
+		Scan(&settings.WhitelistOnlyUntil, &settings.UpdatedAt)
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/models"
+	"github.com/lib/pq"
+)
+
+// DepositAddressChannel is notified with "chain:address" on every new deposit (see migrations)
+const DepositAddressChannel = "deposit_addresses"
+
+// ListenDepositAddresses calls onAddress for deposit addresses created by any instance.
+// Notifications sent before listening started or while connection was down are lost,
+// so resync is called once listening and after every reconnect to reload state.
+// Blocks until ctx is done.
+func ListenDepositAddresses(ctx context.Context, dsn string, onAddress func(chain models.Chain, address string), resync func()) error {
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Printf("Deposit address listener error: %v\n", err)
+		}
+		if event == pq.ListenerEventReconnected {
+			resync()
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(DepositAddressChannel); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	resync()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				continue // connection re-established, handled by resync
+			}
+			chain, address, ok := strings.Cut(n.Extra, ":")
+			if !ok {
+				fmt.Printf("Warning: bad deposit address notification: %q\n", n.Extra)
+				continue
+			}
+			onAddress(models.Chain(chain), address)
+		case <-time.After(90 * time.Second):
+			// Check connection is still alive
+			go listener.Ping()
+		}
+	}
+}
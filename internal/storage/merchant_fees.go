@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// GetMerchantFeeSettings returns merchant's fee payer policy, fees on top if merchant has none
+func (s *PostgresStorage) GetMerchantFeeSettings(merchantID string) (*models.MerchantFeeSettings, error) {
+	settings := &models.MerchantFeeSettings{MerchantID: merchantID, FeeMode: models.FeeModeOnTop}
+	query := `SELECT fee_mode, updated_at FROM merchant_fee_settings WHERE merchant_id = $1`
+	err := s.db.QueryRow(query, merchantID).Scan(&settings.FeeMode, &settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (s *PostgresStorage) SetMerchantFeeSettings(settings *models.MerchantFeeSettings) error {
+	query := `
+		INSERT INTO merchant_fee_settings (merchant_id, fee_mode)
+		VALUES ($1, $2)
+		ON CONFLICT (merchant_id) DO UPDATE SET fee_mode = EXCLUDED.fee_mode, updated_at = NOW()
+		RETURNING updated_at
+	`
+	return s.db.QueryRow(query, settings.MerchantID, settings.FeeMode).Scan(&settings.UpdatedAt)
+}
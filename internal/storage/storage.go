@@ -1,23 +1,87 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dechat/exchange-service/internal/models"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Storage interface {
 	CreateDeposit(deposit *models.Deposit) error
+	CreateDepositFromPool(deposit *models.Deposit) (bool, error)
+	RefillPool(chain models.Chain, size, batch int, generate func() (string, error)) (int, error)
+	GetDepositByID(id int64) (*models.Deposit, error)
 	GetDepositByAddress(chain models.Chain, address string) (*models.Deposit, error)
+	GetStaticDeposit(chain models.Chain, userID string) (*models.Deposit, error)
+	GetWatchedAddresses(chain models.Chain) ([]string, error)
+	GetDepositsByAddresses(chain models.Chain, addresses []string) (map[string]*models.Deposit, error)
 	UpdateDeposit(deposit *models.Deposit) error
-	CreateWithdrawal(withdrawal *models.Withdrawal) error
-	GetPendingWithdrawals(chain models.Chain, limit int) ([]*models.Withdrawal, error)
-	UpdateWithdrawal(withdrawal *models.Withdrawal) error
-	GetHotWallet(chain models.Chain) (*models.HotWallet, error)
-	UpdateHotWalletBalance(chain models.Chain, balance string) error
+	ResolveDeposit(deposit *models.Deposit) error
+	SetDepositRefundWithdrawal(depositID, withdrawalID int64) error
+	ReopenDepositResolution(depositID int64, previous models.DepositResolution) error
+	ExpireDeposits() ([]*models.Deposit, error)
+	MarkDepositDetected(id int64, txHash string) (bool, error)
+	CreateDepositTransfer(transfer *models.DepositTransfer) (bool, error)
+	GetDepositTransfers(depositID int64) ([]*models.DepositTransfer, error)
+	GetUnconfirmedDepositTransfers(chain models.Chain) ([]*models.DepositTransfer, error)
+	UpdateDepositTransfer(transfer *models.DepositTransfer) error
+	DeleteDepositTransfer(id int64) error
+	GetUserCredits(chain models.Chain, userID string) ([]*models.DepositTransfer, error)
+	GetWrongAssetTransfers(chain models.Chain) ([]*models.DepositTransfer, error)
+	CreateWithdrawal(withdrawal *models.Withdrawal) (bool, error)
+	ClaimWithdrawals(chain models.Chain, owner string, lease time.Duration, limit int) ([]*models.Withdrawal, error)
+	UpdateClaimedWithdrawal(withdrawal *models.Withdrawal) error
+	GetWithdrawalByID(id int64) (*models.Withdrawal, error)
+	GetWithdrawalByIdempotencyKey(merchantID, key string) (*models.Withdrawal, error)
+	ListWithdrawals(status models.WithdrawalStatus, limit int) ([]*models.Withdrawal, error)
+	GetSentWithdrawals(chain models.Chain) ([]*models.Withdrawal, error)
+	UpdateSentWithdrawal(withdrawal *models.Withdrawal, txHash string) (bool, error)
+	CreateWithdrawalEvent(event *models.WithdrawalEvent) error
+	GetWithdrawalEvents(withdrawalID int64) ([]*models.WithdrawalEvent, error)
+	DecideWithdrawal(approval *models.WithdrawalApproval) (*models.Withdrawal, error)
+	CancelWithdrawal(id int64, reason string) (*models.Withdrawal, error)
+	CheckWithdrawalLimits(withdrawal *models.Withdrawal) error
+	CreateWithdrawalLimit(limit *models.WithdrawalLimit) error
+	ListWithdrawalLimits(userID string) ([]*models.WithdrawalLimit, error)
+	DeleteWithdrawalLimit(id int64) (bool, error)
+	CreateWithdrawalAddress(address *models.WithdrawalAddress) error
+	GetWithdrawalAddress(userID string, chain models.Chain, address string) (*models.WithdrawalAddress, error)
+	ListWithdrawalAddresses(userID string, chain models.Chain) ([]*models.WithdrawalAddress, error)
+	DeleteWithdrawalAddress(userID string, id int64) (bool, error)
+	GetWithdrawalSettings(userID string) (*models.WithdrawalSettings, error)
+	SetWithdrawalSettings(settings *models.WithdrawalSettings, cooldown time.Duration) error
+	GetWithdrawalApprovals(withdrawalID int64) ([]*models.WithdrawalApproval, error)
+	GetMerchantFeeSettings(merchantID string) (*models.MerchantFeeSettings, error)
+	SetMerchantFeeSettings(settings *models.MerchantFeeSettings) error
+	GetHotWalletByID(id int64) (*models.HotWallet, error)
+	GetActiveHotWallets(chain models.Chain) ([]*models.HotWallet, error)
+	UpdateHotWalletBalance(id int64, balance string) error
+	CreateHotWallet(wallet *models.HotWallet) error
+	ListHotWallets(chain models.Chain) ([]*models.HotWallet, error)
+	RetireHotWallet(id int64) error
+	RotateHotWallet(oldID int64, wallet *models.HotWallet) error
+	WithHotWalletLock(ctx context.Context, chain models.Chain, address string, fn func() error) error
+	CreateWalletTransfer(transfer *models.WalletTransfer) error
+	GetWalletTransfer(id int64) (*models.WalletTransfer, error)
+	GetOpenWalletTransfers(chain models.Chain) ([]*models.WalletTransfer, error)
+	UpdateWalletTransfer(transfer *models.WalletTransfer) error
+	SaveTransferBundle(id int64, bundle string) error
+	MarkTransferSent(transfer *models.WalletTransfer, bundle string) error
+	GetMonitorProgress(chain models.Chain) (int64, error)
+	SaveMonitorProgress(chain models.Chain, lastBlock int64) error
+
+	CreateRescanJob(job *models.RescanJob) error
+	GetRescanJob(id int64) (*models.RescanJob, error)
+	ListRescanJobs(limit int) ([]*models.RescanJob, error)
+	ClaimRescanJob(chains []models.Chain, staleAfter time.Duration) (*models.RescanJob, error)
+	UpdateRescanJob(job *models.RescanJob) error
 	Close() error
 }
 
@@ -25,6 +89,23 @@ type PostgresStorage struct {
 	db *sql.DB
 }
 
+// Small interfaces so helpers work with both *sql.DB and *sql.Tx
+type (
+	rowScanner interface {
+		Scan(dest ...any) error
+	}
+	queryRower interface {
+		QueryRow(query string, args ...any) *sql.Row
+	}
+	execer interface {
+		Exec(query string, args ...any) (sql.Result, error)
+	}
+	querier interface {
+		Query(query string, args ...any) (*sql.Rows, error)
+		QueryRow(query string, args ...any) *sql.Row
+	}
+)
+
 func New(dsn string) (*PostgresStorage, error) {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
@@ -43,60 +124,203 @@ func (s *PostgresStorage) Close() error {
 }
 
 // Deposit methods
+const depositColumns = `id, chain, address, user_id, order_id, mode, asset, expected_amount,
+		       COALESCE(received_amount, '0'), COALESCE(tx_hash, ''), COALESCE(block_number, 0),
+		       COALESCE(confirmations, 0), status, resolution, refund_address, refund_amount,
+		       refund_withdrawal_id, created_at, confirmed_at, resolved_at, expires_at, watch_until,
+		       detected_tx_hash, detected_at`
+
+func scanDeposit(row rowScanner) (*models.Deposit, error) {
+	deposit := &models.Deposit{}
+	err := row.Scan(
+		&deposit.ID,
+		&deposit.Chain,
+		&deposit.Address,
+		&deposit.UserID,
+		&deposit.OrderID,
+		&deposit.Mode,
+		&deposit.Asset,
+		&deposit.ExpectedAmount,
+		&deposit.ReceivedAmount,
+		&deposit.TxHash,
+		&deposit.BlockNumber,
+		&deposit.Confirmations,
+		&deposit.Status,
+		&deposit.Resolution,
+		&deposit.RefundAddress,
+		&deposit.RefundAmount,
+		&deposit.RefundWithdrawalID,
+		&deposit.CreatedAt,
+		&deposit.ConfirmedAt,
+		&deposit.ResolvedAt,
+		&deposit.ExpiresAt,
+		&deposit.WatchUntil,
+		&deposit.DetectedTxHash,
+		&deposit.DetectedAt,
+	)
+	return deposit, err
+}
+
 func (s *PostgresStorage) CreateDeposit(deposit *models.Deposit) error {
+	return createDeposit(s.db, deposit)
+}
+
+func createDeposit(db queryRower, deposit *models.Deposit) error {
 	query := `
-		INSERT INTO deposits (chain, address, user_id, order_id, expected_amount, status)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO deposits (chain, address, user_id, order_id, mode, asset, expected_amount, status, expires_at, watch_until)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at
 	`
-	return s.db.QueryRow(
+	return db.QueryRow(
 		query,
 		deposit.Chain,
 		deposit.Address,
 		deposit.UserID,
 		deposit.OrderID,
+		deposit.Mode,
+		deposit.Asset,
 		deposit.ExpectedAmount,
 		deposit.Status,
+		deposit.ExpiresAt,
+		deposit.WatchUntil,
 	).Scan(&deposit.ID, &deposit.CreatedAt)
 }
 
+// CreateDepositFromPool assigns pre-generated pool address to deposit and saves it atomically.
+// Returns false if pool of deposit chain is empty.
+func (s *PostgresStorage) CreateDepositFromPool(deposit *models.Deposit) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM deposit_address_pool
+		WHERE id = (
+			SELECT id FROM deposit_address_pool
+			WHERE chain = $1
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING address
+	`
+	var address string
+	if err := tx.QueryRow(query, deposit.Chain).Scan(&address); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	deposit.Address = address
+	if err := createDeposit(tx, deposit); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *PostgresStorage) GetDepositByID(id int64) (*models.Deposit, error) {
+	query := `
+		SELECT ` + depositColumns + `
+		FROM deposits
+		WHERE id = $1
+	`
+	deposit, err := scanDeposit(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return deposit, err
+}
+
+// GetDepositByAddress returns latest deposit for address which is still watched
 func (s *PostgresStorage) GetDepositByAddress(chain models.Chain, address string) (*models.Deposit, error) {
-	deposit := &models.Deposit{}
 	query := `
-		SELECT id, chain, address, user_id, order_id, expected_amount, received_amount,
-		       tx_hash, block_number, confirmations, status, created_at, confirmed_at
+		SELECT ` + depositColumns + `
 		FROM deposits
-		WHERE chain = $1 AND address = $2
+		WHERE chain = $1 AND address = $2 AND (watch_until IS NULL OR watch_until > NOW())
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
-	err := s.db.QueryRow(query, chain, address).Scan(
-		&deposit.ID,
-		&deposit.Chain,
-		&deposit.Address,
-		&deposit.UserID,
-		&deposit.OrderID,
-		&deposit.ExpectedAmount,
-		&deposit.ReceivedAmount,
-		&deposit.TxHash,
-		&deposit.BlockNumber,
-		&deposit.Confirmations,
-		&deposit.Status,
-		&deposit.CreatedAt,
-		&deposit.ConfirmedAt,
-	)
+	deposit, err := scanDeposit(s.db.QueryRow(query, chain, address))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return deposit, err
+}
+
+// GetDepositsByAddresses returns latest deposit of each address that has one, watched or not.
+// Used by rescan, old blocks may pay deposits whose watch window is over.
+func (s *PostgresStorage) GetDepositsByAddresses(chain models.Chain, addresses []string) (map[string]*models.Deposit, error) {
+	query := `
+		SELECT DISTINCT ON (address) ` + depositColumns + `
+		FROM deposits
+		WHERE chain = $1 AND address = ANY($2)
+		ORDER BY address, created_at DESC
+	`
+	rows, err := s.db.Query(query, chain, pq.Array(addresses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deposits := make(map[string]*models.Deposit)
+	for rows.Next() {
+		deposit, err := scanDeposit(rows)
+		if err != nil {
+			return nil, err
+		}
+		deposits[deposit.Address] = deposit
+	}
+	return deposits, rows.Err()
+}
+
+// GetWatchedAddresses returns deposit addresses still watched by monitor
+func (s *PostgresStorage) GetWatchedAddresses(chain models.Chain) ([]string, error) {
+	query := `
+		SELECT DISTINCT address
+		FROM deposits
+		WHERE chain = $1 AND (watch_until IS NULL OR watch_until > NOW())
+	`
+	rows, err := s.db.Query(query, chain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []string
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+func (s *PostgresStorage) GetStaticDeposit(chain models.Chain, userID string) (*models.Deposit, error) {
+	query := `
+		SELECT ` + depositColumns + `
+		FROM deposits
+		WHERE chain = $1 AND user_id = $2 AND mode = 'static'
+	`
+	deposit, err := scanDeposit(s.db.QueryRow(query, chain, userID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return deposit, err
 }
 
+// UpdateDeposit saves payment progress, resolution is only changed by ResolveDeposit
 func (s *PostgresStorage) UpdateDeposit(deposit *models.Deposit) error {
 	query := `
 		UPDATE deposits
 		SET received_amount = $1, tx_hash = $2, block_number = $3,
-		    confirmations = $4, status = $5, confirmed_at = $6
-		WHERE id = $7
+		    confirmations = $4, status = $5, confirmed_at = $6,
+		    detected_tx_hash = $7, detected_at = $8
+		WHERE id = $9
 	`
 	_, err := s.db.Exec(
 		query,
@@ -106,120 +330,1219 @@ func (s *PostgresStorage) UpdateDeposit(deposit *models.Deposit) error {
 		deposit.Confirmations,
 		deposit.Status,
 		deposit.ConfirmedAt,
+		deposit.DetectedTxHash,
+		deposit.DetectedAt,
 		deposit.ID,
 	)
 	return err
 }
 
-// Withdrawal methods
-func (s *PostgresStorage) CreateWithdrawal(withdrawal *models.Withdrawal) error {
+// ErrDepositChanged is returned when deposit was paid more or resolved since it was read
+var ErrDepositChanged = errors.New("deposit changed, read it again")
+
+// ResolveDeposit saves resolution and refund of deposit if its status and received amount are still
+// the ones resolution was decided on and it isn't resolved yet (top up can still be changed)
+func (s *PostgresStorage) ResolveDeposit(deposit *models.Deposit) error {
 	query := `
-		INSERT INTO withdrawals (chain, order_id, from_address, to_address, amount, fee, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, created_at
+		UPDATE deposits
+		SET resolution = $2, refund_address = $3, refund_amount = $4, resolved_at = NOW()
+		WHERE id = $1 AND status = $5 AND received_amount = $6 AND resolution IN ('', 'top_up')
+		RETURNING resolved_at
 	`
-	return s.db.QueryRow(
+	err := s.db.QueryRow(
 		query,
-		withdrawal.Chain,
-		withdrawal.OrderID,
-		withdrawal.FromAddress,
-		withdrawal.ToAddress,
-		withdrawal.Amount,
-		withdrawal.Fee,
-		withdrawal.Status,
-	).Scan(&withdrawal.ID, &withdrawal.CreatedAt)
+		deposit.ID,
+		deposit.Resolution,
+		deposit.RefundAddress,
+		deposit.RefundAmount,
+		deposit.Status,
+		deposit.ReceivedAmount,
+	).Scan(&deposit.ResolvedAt)
+	if err == sql.ErrNoRows {
+		return ErrDepositChanged
+	}
+	return err
+}
+
+// SetDepositRefundWithdrawal links refund withdrawal to deposit resolved with refund
+func (s *PostgresStorage) SetDepositRefundWithdrawal(depositID, withdrawalID int64) error {
+	query := `UPDATE deposits SET refund_withdrawal_id = $2 WHERE id = $1 AND resolution = 'refund'`
+	_, err := s.db.Exec(query, depositID, withdrawalID)
+	return err
 }
 
-func (s *PostgresStorage) GetPendingWithdrawals(chain models.Chain, limit int) ([]*models.Withdrawal, error) {
+// ReopenDepositResolution restores previous resolution of deposit whose refund couldn't be created
+func (s *PostgresStorage) ReopenDepositResolution(depositID int64, previous models.DepositResolution) error {
 	query := `
-		SELECT id, chain, order_id, from_address, to_address, amount, fee,
-		       tx_hash, status, block_number, confirmations, created_at, sent_at, confirmed_at
-		FROM withdrawals
-		WHERE chain = $1 AND status = 'pending'
-		ORDER BY created_at ASC
-		LIMIT $2
+		UPDATE deposits
+		SET resolution = $2, refund_address = '', refund_amount = '0', resolved_at = NULL
+		WHERE id = $1 AND resolution = 'refund' AND refund_withdrawal_id IS NULL
 	`
-	rows, err := s.db.Query(query, chain, limit)
+	_, err := s.db.Exec(query, depositID, previous)
+	return err
+}
+
+// ExpireDeposits marks pending deposits past expires_at without any incoming transfer as expired.
+// Detected deposits whose transaction never got mined expire too.
+func (s *PostgresStorage) ExpireDeposits() ([]*models.Deposit, error) {
+	query := `
+		UPDATE deposits
+		SET status = 'expired'
+		WHERE status IN ('pending', 'detected') AND expires_at <= NOW()
+		  AND NOT EXISTS (SELECT 1 FROM deposit_transfers t WHERE t.deposit_id = deposits.id AND NOT t.wrong_asset)
+		RETURNING ` + depositColumns
+	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var withdrawals []*models.Withdrawal
+	var deposits []*models.Deposit
 	for rows.Next() {
-		w := &models.Withdrawal{}
-		err := rows.Scan(
-			&w.ID,
-			&w.Chain,
-			&w.OrderID,
-			&w.FromAddress,
-			&w.ToAddress,
-			&w.Amount,
-			&w.Fee,
-			&w.TxHash,
-			&w.Status,
-			&w.BlockNumber,
-			&w.Confirmations,
-			&w.CreatedAt,
-			&w.SentAt,
-			&w.ConfirmedAt,
-		)
+		deposit, err := scanDeposit(rows)
 		if err != nil {
 			return nil, err
 		}
-		withdrawals = append(withdrawals, w)
+		deposits = append(deposits, deposit)
 	}
-	return withdrawals, rows.Err()
+	return deposits, rows.Err()
 }
 
-func (s *PostgresStorage) UpdateWithdrawal(withdrawal *models.Withdrawal) error {
+// MarkDepositDetected moves pending deposit to detected, returns false if it's not pending anymore
+func (s *PostgresStorage) MarkDepositDetected(id int64, txHash string) (bool, error) {
 	query := `
-		UPDATE withdrawals
-		SET tx_hash = $1, status = $2, block_number = $3,
-		    confirmations = $4, sent_at = $5, confirmed_at = $6
-		WHERE id = $7
+		UPDATE deposits
+		SET status = 'detected', detected_tx_hash = $1, detected_at = NOW()
+		WHERE id = $2 AND status = 'pending'
 	`
-	_, err := s.db.Exec(
-		query,
-		withdrawal.TxHash,
-		withdrawal.Status,
-		withdrawal.BlockNumber,
-		withdrawal.Confirmations,
-		withdrawal.SentAt,
-		withdrawal.ConfirmedAt,
-		withdrawal.ID,
+	res, err := s.db.Exec(query, txHash, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Deposit address pool methods
+
+// RefillPool adds up to batch addresses from generate so chain's pool has size addresses, returns pool size.
+// Count and inserts run under chain advisory lock, so instances refilling at the same time don't overfill.
+func (s *PostgresStorage) RefillPool(chain models.Chain, size, batch int, generate func() (string, error)) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "deposit_address_pool/"+string(chain)); err != nil {
+		return 0, err
+	}
+
+	var available int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM deposit_address_pool WHERE chain = $1`, chain).Scan(&available); err != nil {
+		return 0, err
+	}
+
+	missing := min(size-available, batch)
+	for i := 0; i < missing; i++ {
+		address, err := generate()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`INSERT INTO deposit_address_pool (chain, address) VALUES ($1, $2)`, chain, address); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return available + max(missing, 0), nil
+}
+
+// DepositTransfer methods
+const depositTransferColumns = `id, deposit_id, chain, tx_hash, log_index, from_address, asset, amount,
+		       block_number, block_hash, confirmations, confirmed, late, wrong_asset, created_at, confirmed_at`
+
+func scanDepositTransfer(row rowScanner) (*models.DepositTransfer, error) {
+	t := &models.DepositTransfer{}
+	err := row.Scan(
+		&t.ID,
+		&t.DepositID,
+		&t.Chain,
+		&t.TxHash,
+		&t.LogIndex,
+		&t.FromAddress,
+		&t.Asset,
+		&t.Amount,
+		&t.BlockNumber,
+		&t.BlockHash,
+		&t.Confirmations,
+		&t.Confirmed,
+		&t.Late,
+		&t.WrongAsset,
+		&t.CreatedAt,
+		&t.ConfirmedAt,
 	)
-	return err
+	return t, err
 }
 
-// HotWallet methods
-func (s *PostgresStorage) GetHotWallet(chain models.Chain) (*models.HotWallet, error) {
-	wallet := &models.HotWallet{}
+func scanDepositTransfers(rows *sql.Rows) ([]*models.DepositTransfer, error) {
+	defer rows.Close()
+
+	var transfers []*models.DepositTransfer
+	for rows.Next() {
+		t, err := scanDepositTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+// CreateDepositTransfer records transfer, returns false if (chain, tx_hash, log_index) is already known.
+// Unconfirmed transfer seen again in other block (tx was re-mined after reorg) moves to that block.
+func (s *PostgresStorage) CreateDepositTransfer(transfer *models.DepositTransfer) (bool, error) {
 	query := `
-		SELECT id, chain, address, encrypted_key, balance, last_checked_at
-		FROM hot_wallets
-		WHERE chain = $1
+		INSERT INTO deposit_transfers (deposit_id, chain, tx_hash, log_index, from_address, asset, amount, block_number, confirmations, late, wrong_asset, block_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (chain, tx_hash, log_index) DO UPDATE
+		SET block_number = EXCLUDED.block_number, block_hash = EXCLUDED.block_hash
+		WHERE NOT deposit_transfers.confirmed AND deposit_transfers.block_hash <> EXCLUDED.block_hash
+		RETURNING (xmax = 0), id, created_at
 	`
-	err := s.db.QueryRow(query, chain).Scan(
-		&wallet.ID,
-		&wallet.Chain,
-		&wallet.Address,
-		&wallet.EncryptedKey,
-		&wallet.Balance,
-		&wallet.LastCheckedAt,
-	)
+	// xmax is 0 only for inserted row, moved one isn't new
+	var created bool
+	err := s.db.QueryRow(
+		query,
+		transfer.DepositID,
+		transfer.Chain,
+		transfer.TxHash,
+		transfer.LogIndex,
+		transfer.FromAddress,
+		transfer.Asset,
+		transfer.Amount,
+		transfer.BlockNumber,
+		transfer.Confirmations,
+		transfer.Late,
+		transfer.WrongAsset,
+		transfer.BlockHash,
+	).Scan(&created, &transfer.ID, &transfer.CreatedAt)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return false, nil
 	}
-	return wallet, err
+	return created, err
 }
 
-func (s *PostgresStorage) UpdateHotWalletBalance(chain models.Chain, balance string) error {
+func (s *PostgresStorage) GetDepositTransfers(depositID int64) ([]*models.DepositTransfer, error) {
 	query := `
-		UPDATE hot_wallets
-		SET balance = $1, last_checked_at = $2
-		WHERE chain = $3
+		SELECT ` + depositTransferColumns + `
+		FROM deposit_transfers
+		WHERE deposit_id = $1
+		ORDER BY block_number, log_index
+	`
+	rows, err := s.db.Query(query, depositID)
+	if err != nil {
+		return nil, err
+	}
+	return scanDepositTransfers(rows)
+}
+
+func (s *PostgresStorage) GetUnconfirmedDepositTransfers(chain models.Chain) ([]*models.DepositTransfer, error) {
+	query := `
+		SELECT ` + depositTransferColumns + `
+		FROM deposit_transfers
+		WHERE chain = $1 AND NOT confirmed
+		ORDER BY block_number, log_index
+	`
+	rows, err := s.db.Query(query, chain)
+	if err != nil {
+		return nil, err
+	}
+	return scanDepositTransfers(rows)
+}
+
+func (s *PostgresStorage) UpdateDepositTransfer(transfer *models.DepositTransfer) error {
+	query := `
+		UPDATE deposit_transfers
+		SET confirmations = $1, confirmed = $2, confirmed_at = $3
+		WHERE id = $4
 	`
-	_, err := s.db.Exec(query, balance, time.Now(), chain)
+	_, err := s.db.Exec(query, transfer.Confirmations, transfer.Confirmed, transfer.ConfirmedAt, transfer.ID)
+	return err
+}
+
+// DeleteDepositTransfer drops unconfirmed transfer whose block was reorged out
+func (s *PostgresStorage) DeleteDepositTransfer(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM deposit_transfers WHERE id = $1 AND NOT confirmed`, id)
 	return err
 }
+
+// GetUserCredits returns transfers to user's static addresses, chain "" means all chains
+func (s *PostgresStorage) GetUserCredits(chain models.Chain, userID string) ([]*models.DepositTransfer, error) {
+	query := `
+		SELECT ` + depositTransferColumns + `
+		FROM deposit_transfers
+		WHERE deposit_id IN (
+			SELECT id FROM deposits
+			WHERE mode = 'static' AND user_id = $1 AND ($2 = '' OR chain::text = $2)
+		)
+		ORDER BY created_at, id
+	`
+	rows, err := s.db.Query(query, userID, string(chain))
+	if err != nil {
+		return nil, err
+	}
+	return scanDepositTransfers(rows)
+}
+
+// GetWrongAssetTransfers returns transfers of unexpected asset to deposit addresses of chain for ops refunds
+func (s *PostgresStorage) GetWrongAssetTransfers(chain models.Chain) ([]*models.DepositTransfer, error) {
+	query := `
+		SELECT ` + depositTransferColumns + `
+		FROM deposit_transfers
+		WHERE chain = $1 AND wrong_asset
+		ORDER BY created_at, id
+	`
+	rows, err := s.db.Query(query, chain)
+	if err != nil {
+		return nil, err
+	}
+	return scanDepositTransfers(rows)
+}
+
+// Withdrawal methods
+const withdrawalColumns = `id, chain, user_id, order_id, COALESCE(idempotency_key, ''), from_address, to_address, to_label, to_contract, asset, amount, fee,
+		       COALESCE(tx_hash, ''), status, COALESCE(block_number, 0), COALESCE(confirmations, 0),
+		       created_at, sent_at, confirmed_at, lease_owner, lease_expires_at, raw_tx,
+		       attempts, next_attempt_at, last_error, failure_reason, required_approvals, approval_reason,
+		       merchant_id, fee_mode, quoted_fee, service_fee, receive_amount, not_before, priority`
+
+// scanWithdrawal scans withdrawalColumns followed by extra columns
+func scanWithdrawal(row rowScanner, extra ...any) (*models.Withdrawal, error) {
+	w := &models.Withdrawal{}
+	dest := []any{
+		&w.ID,
+		&w.Chain,
+		&w.UserID,
+		&w.OrderID,
+		&w.IdempotencyKey,
+		&w.FromAddress,
+		&w.ToAddress,
+		&w.ToLabel,
+		&w.ToContract,
+		&w.Asset,
+		&w.Amount,
+		&w.Fee,
+		&w.TxHash,
+		&w.Status,
+		&w.BlockNumber,
+		&w.Confirmations,
+		&w.CreatedAt,
+		&w.SentAt,
+		&w.ConfirmedAt,
+		&w.LeaseOwner,
+		&w.LeaseExpiresAt,
+		&w.RawTx,
+		&w.Attempts,
+		&w.NextAttemptAt,
+		&w.LastError,
+		&w.FailureReason,
+		&w.RequiredApprovals,
+		&w.ApprovalReason,
+		&w.MerchantID,
+		&w.FeeMode,
+		&w.QuotedFee,
+		&w.ServiceFee,
+		&w.ReceiveAmount,
+		&w.NotBefore,
+		&w.Priority,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return w, err
+}
+
+func scanWithdrawals(rows *sql.Rows) ([]*models.Withdrawal, error) {
+	defer rows.Close()
+
+	var withdrawals []*models.Withdrawal
+	for rows.Next() {
+		w, err := scanWithdrawal(rows)
+		if err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, w)
+	}
+	return withdrawals, rows.Err()
+}
+
+// ErrIdempotencyConflict is returned when idempotency key was already used for different withdrawal
+var ErrIdempotencyConflict = errors.New("idempotency key already used with different request")
+
+// CreateWithdrawal inserts withdrawal unless merchant already has one with the same idempotency key.
+// Existing withdrawal is loaded into withdrawal and false returned if it matches request
+// (chain, order, recipient, amount), otherwise ErrIdempotencyConflict.
+// Check is done by unique index and conflict clause, so concurrent requests can't both insert.
+func (s *PostgresStorage) CreateWithdrawal(withdrawal *models.Withdrawal) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Creations of chain asset are serialized, so concurrent withdrawals can't both fit into the same limit
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, string(withdrawal.Chain)+"/"+withdrawal.Asset); err != nil {
+		return false, err
+	}
+
+	// Replayed request returns original withdrawal even if limits are used up since
+	var replay bool
+	query := `SELECT EXISTS (SELECT 1 FROM withdrawals WHERE merchant_id = $1 AND idempotency_key = $2)`
+	if err := tx.QueryRow(query, withdrawal.MerchantID, withdrawal.IdempotencyKey).Scan(&replay); err != nil {
+		return false, err
+	}
+	if !replay {
+		if err := checkWithdrawalLimits(tx, withdrawal); err != nil {
+			return false, err
+		}
+	}
+
+	query = `
+		INSERT INTO withdrawals (chain, order_id, idempotency_key, from_address, to_address, amount, fee, status,
+		                         user_id, required_approvals, approval_reason, asset, to_label, to_contract,
+		                         merchant_id, fee_mode, quoted_fee, service_fee, receive_amount, not_before, priority)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		ON CONFLICT (merchant_id, idempotency_key) DO UPDATE SET idempotency_key = EXCLUDED.idempotency_key
+		WHERE withdrawals.chain = EXCLUDED.chain
+		  AND withdrawals.user_id = EXCLUDED.user_id
+		  AND withdrawals.order_id = EXCLUDED.order_id
+		  AND withdrawals.to_address = EXCLUDED.to_address
+		  AND withdrawals.asset = EXCLUDED.asset
+		  AND withdrawals.amount = EXCLUDED.amount
+		RETURNING ` + withdrawalColumns + `, (xmax = 0)
+	`
+	var created bool
+	existing, err := scanWithdrawal(tx.QueryRow(
+		query,
+		withdrawal.Chain,
+		withdrawal.OrderID,
+		withdrawal.IdempotencyKey,
+		withdrawal.FromAddress,
+		withdrawal.ToAddress,
+		withdrawal.Amount,
+		withdrawal.Fee,
+		withdrawal.Status,
+		withdrawal.UserID,
+		withdrawal.RequiredApprovals,
+		withdrawal.ApprovalReason,
+		withdrawal.Asset,
+		withdrawal.ToLabel,
+		withdrawal.ToContract,
+		withdrawal.MerchantID,
+		withdrawal.FeeMode,
+		withdrawal.QuotedFee,
+		withdrawal.ServiceFee,
+		withdrawal.ReceiveAmount,
+		withdrawal.NotBefore,
+		withdrawal.Priority,
+	), &created)
+	if err == sql.ErrNoRows {
+		// Conflict clause WHERE didn't match: same key, different request
+		return false, ErrIdempotencyConflict
+	}
+	if err != nil {
+		return false, err
+	}
+
+	*withdrawal = *existing
+	return created, tx.Commit()
+}
+
+// ErrLeaseLost is returned when withdrawal lease expired and was taken over by another instance
+var ErrLeaseLost = errors.New("withdrawal lease lost")
+
+// ClaimWithdrawals moves up to limit pending withdrawals due for attempt and past their schedule, and processing
+// ones with expired lease, to processing owned by owner until lease expires. Urgent withdrawals are claimed first,
+// low priority ones last. Rows locked by other instances are skipped.
+func (s *PostgresStorage) ClaimWithdrawals(chain models.Chain, owner string, lease time.Duration, limit int) ([]*models.Withdrawal, error) {
+	query := `
+		UPDATE withdrawals
+		SET status = 'processing', lease_owner = $2, lease_expires_at = NOW() + $3 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM withdrawals
+			WHERE chain = $1
+			  AND ((status = 'pending' AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+			        AND (not_before IS NULL OR not_before <= NOW()))
+			       OR (status = 'processing' AND lease_expires_at < NOW()))
+			ORDER BY CASE priority WHEN 'urgent' THEN 0 WHEN 'normal' THEN 1 ELSE 2 END, created_at ASC
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + withdrawalColumns
+	rows, err := s.db.Query(query, chain, owner, int64(lease.Seconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWithdrawals(rows)
+}
+
+// UpdateClaimedWithdrawal saves withdrawal only while it's still processing under the same lease
+func (s *PostgresStorage) UpdateClaimedWithdrawal(withdrawal *models.Withdrawal) error {
+	query := `
+		UPDATE withdrawals
+		SET tx_hash = $1, status = $2, sent_at = $3, from_address = $4, fee = $5,
+		    raw_tx = $6, lease_expires_at = $7, attempts = $8, next_attempt_at = $9,
+		    last_error = $10, failure_reason = $11
+		WHERE id = $12 AND status = 'processing' AND lease_owner = $13
+	`
+	result, err := s.db.Exec(
+		query,
+		withdrawal.TxHash,
+		withdrawal.Status,
+		withdrawal.SentAt,
+		withdrawal.FromAddress,
+		withdrawal.Fee,
+		withdrawal.RawTx,
+		withdrawal.LeaseExpiresAt,
+		withdrawal.Attempts,
+		withdrawal.NextAttemptAt,
+		withdrawal.LastError,
+		withdrawal.FailureReason,
+		withdrawal.ID,
+		withdrawal.LeaseOwner,
+	)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *PostgresStorage) GetWithdrawalByID(id int64) (*models.Withdrawal, error) {
+	query := `
+		SELECT ` + withdrawalColumns + `
+		FROM withdrawals
+		WHERE id = $1
+	`
+	withdrawal, err := scanWithdrawal(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return withdrawal, err
+}
+
+// GetWithdrawalByIdempotencyKey returns withdrawal of merchant created with idempotency key, nil if none
+func (s *PostgresStorage) GetWithdrawalByIdempotencyKey(merchantID, key string) (*models.Withdrawal, error) {
+	query := `
+		SELECT ` + withdrawalColumns + `
+		FROM withdrawals
+		WHERE merchant_id = $1 AND idempotency_key = $2
+	`
+	withdrawal, err := scanWithdrawal(s.db.QueryRow(query, merchantID, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return withdrawal, err
+}
+
+// ListWithdrawals returns latest withdrawals with status, "" for any status
+func (s *PostgresStorage) ListWithdrawals(status models.WithdrawalStatus, limit int) ([]*models.Withdrawal, error) {
+	query := `
+		SELECT ` + withdrawalColumns + `
+		FROM withdrawals
+		WHERE $1 = '' OR status::text = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	rows, err := s.db.Query(query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWithdrawals(rows)
+}
+
+// GetSentWithdrawals returns withdrawals broadcast but not confirmed yet
+func (s *PostgresStorage) GetSentWithdrawals(chain models.Chain) ([]*models.Withdrawal, error) {
+	query := `
+		SELECT ` + withdrawalColumns + `
+		FROM withdrawals
+		WHERE chain = $1 AND status = 'sent'
+		ORDER BY sent_at ASC
+	`
+	rows, err := s.db.Query(query, chain)
+	if err != nil {
+		return nil, err
+	}
+	return scanWithdrawals(rows)
+}
+
+// UpdateSentWithdrawal saves result of sent withdrawal check if it's still sent with txHash,
+// returns false if another instance already updated it
+func (s *PostgresStorage) UpdateSentWithdrawal(withdrawal *models.Withdrawal, txHash string) (bool, error) {
+	query := `
+		UPDATE withdrawals
+		SET tx_hash = $1, status = $2, block_number = $3,
+		    confirmations = $4, sent_at = $5, confirmed_at = $6,
+		    from_address = $7, fee = $8, failure_reason = $9,
+		    raw_tx = $10, last_error = $11
+		WHERE id = $12 AND status = 'sent' AND tx_hash = $13
+	`
+	result, err := s.db.Exec(
+		query,
+		withdrawal.TxHash,
+		withdrawal.Status,
+		withdrawal.BlockNumber,
+		withdrawal.Confirmations,
+		withdrawal.SentAt,
+		withdrawal.ConfirmedAt,
+		withdrawal.FromAddress,
+		withdrawal.Fee,
+		withdrawal.FailureReason,
+		withdrawal.RawTx,
+		withdrawal.LastError,
+		withdrawal.ID,
+		txHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+var (
+	// ErrNotAwaitingApproval is returned when decision is made on withdrawal not waiting for approval
+	ErrNotAwaitingApproval = errors.New("withdrawal is not awaiting approval")
+	// ErrAlreadyDecided is returned when approver already approved or rejected withdrawal
+	ErrAlreadyDecided = errors.New("approver already decided on withdrawal")
+	// ErrOwnWithdrawal is returned when approver is the user who requested withdrawal
+	ErrOwnWithdrawal = errors.New("approver can't decide on own withdrawal")
+)
+
+// DecideWithdrawal records approver decision. Rejection rejects withdrawal, approval moves it
+// to pending once it has required number of distinct approvals. Returns nil if withdrawal doesn't exist.
+func (s *PostgresStorage) DecideWithdrawal(approval *models.WithdrawalApproval) (*models.Withdrawal, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Row lock serializes concurrent decisions on the same withdrawal
+	query := `
+		SELECT ` + withdrawalColumns + `
+		FROM withdrawals
+		WHERE id = $1
+		FOR UPDATE
+	`
+	withdrawal, err := scanWithdrawal(tx.QueryRow(query, approval.WithdrawalID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if withdrawal.Status != models.WithdrawalStatusAwaitingApproval {
+		return nil, ErrNotAwaitingApproval
+	}
+	if withdrawal.UserID != "" && withdrawal.UserID == approval.Approver {
+		return nil, ErrOwnWithdrawal
+	}
+
+	query = `
+		INSERT INTO withdrawal_approvals (withdrawal_id, approver, decision, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (withdrawal_id, approver) DO NOTHING
+		RETURNING id, created_at
+	`
+	err = tx.QueryRow(query, approval.WithdrawalID, approval.Approver, approval.Decision, approval.Reason).Scan(&approval.ID, &approval.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlreadyDecided
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if approval.Decision == models.ApprovalDecisionRejected {
+		withdrawal.Status = models.WithdrawalStatusRejected
+		withdrawal.FailureReason = fmt.Sprintf("rejected by %s: %s", approval.Approver, approval.Reason)
+	} else {
+		var approvals int
+		query = `SELECT COUNT(*) FROM withdrawal_approvals WHERE withdrawal_id = $1 AND decision = 'approved'`
+		if err := tx.QueryRow(query, approval.WithdrawalID).Scan(&approvals); err != nil {
+			return nil, err
+		}
+		if approvals >= withdrawal.RequiredApprovals {
+			withdrawal.Status = models.WithdrawalStatusPending
+		}
+	}
+
+	query = `UPDATE withdrawals SET status = $1, failure_reason = $2 WHERE id = $3`
+	if _, err := tx.Exec(query, withdrawal.Status, withdrawal.FailureReason, withdrawal.ID); err != nil {
+		return nil, err
+	}
+	return withdrawal, tx.Commit()
+}
+
+// ErrNotCancellable is returned when withdrawal was already claimed for sending or finished
+var ErrNotCancellable = errors.New("withdrawal can't be cancelled")
+
+// CancelWithdrawal cancels withdrawal still pending or awaiting approval. Status is checked by the update
+// itself, so withdrawal claimed concurrently is never cancelled. Returns nil if withdrawal doesn't exist.
+func (s *PostgresStorage) CancelWithdrawal(id int64, reason string) (*models.Withdrawal, error) {
+	query := `
+		UPDATE withdrawals
+		SET status = 'cancelled', failure_reason = $2, next_attempt_at = NULL
+		WHERE id = $1 AND status IN ('pending', 'awaiting_approval')
+		RETURNING ` + withdrawalColumns
+	withdrawal, err := scanWithdrawal(s.db.QueryRow(query, id, reason))
+	if err != sql.ErrNoRows {
+		return withdrawal, err
+	}
+
+	existing, err := s.GetWithdrawalByID(id)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: withdrawal is %s", ErrNotCancellable, existing.Status)
+}
+
+func (s *PostgresStorage) GetWithdrawalApprovals(withdrawalID int64) ([]*models.WithdrawalApproval, error) {
+	query := `
+		SELECT id, withdrawal_id, approver, decision, reason, created_at
+		FROM withdrawal_approvals
+		WHERE withdrawal_id = $1
+		ORDER BY id
+	`
+	rows, err := s.db.Query(query, withdrawalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var approvals []*models.WithdrawalApproval
+	for rows.Next() {
+		approval := &models.WithdrawalApproval{}
+		if err := rows.Scan(&approval.ID, &approval.WithdrawalID, &approval.Approver, &approval.Decision, &approval.Reason, &approval.CreatedAt); err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, approval)
+	}
+	return approvals, rows.Err()
+}
+
+func (s *PostgresStorage) CreateWithdrawalEvent(event *models.WithdrawalEvent) error {
+	query := `
+		INSERT INTO withdrawal_events (withdrawal_id, type, message)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	return s.db.QueryRow(query, event.WithdrawalID, event.Type, event.Message).Scan(&event.ID, &event.CreatedAt)
+}
+
+func (s *PostgresStorage) GetWithdrawalEvents(withdrawalID int64) ([]*models.WithdrawalEvent, error) {
+	query := `
+		SELECT id, withdrawal_id, type, message, created_at
+		FROM withdrawal_events
+		WHERE withdrawal_id = $1
+		ORDER BY id
+	`
+	rows, err := s.db.Query(query, withdrawalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.WithdrawalEvent
+	for rows.Next() {
+		event := &models.WithdrawalEvent{}
+		if err := rows.Scan(&event.ID, &event.WithdrawalID, &event.Type, &event.Message, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// HotWallet methods
+const hotWalletColumns = `id, chain, address, encrypted_key, balance, status, last_checked_at, created_at, retired_at`
+
+func scanHotWallet(row rowScanner) (*models.HotWallet, error) {
+	wallet := &models.HotWallet{}
+	err := row.Scan(
+		&wallet.ID,
+		&wallet.Chain,
+		&wallet.Address,
+		&wallet.EncryptedKey,
+		&wallet.Balance,
+		&wallet.Status,
+		&wallet.LastCheckedAt,
+		&wallet.CreatedAt,
+		&wallet.RetiredAt,
+	)
+	return wallet, err
+}
+
+func (s *PostgresStorage) GetHotWalletByID(id int64) (*models.HotWallet, error) {
+	query := `
+		SELECT ` + hotWalletColumns + `
+		FROM hot_wallets
+		WHERE id = $1
+	`
+	wallet, err := scanHotWallet(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return wallet, err
+}
+
+func (s *PostgresStorage) GetActiveHotWallets(chain models.Chain) ([]*models.HotWallet, error) {
+	query := `
+		SELECT ` + hotWalletColumns + `
+		FROM hot_wallets
+		WHERE chain = $1 AND status = 'active'
+		ORDER BY id
+	`
+	rows, err := s.db.Query(query, chain)
+	if err != nil {
+		return nil, err
+	}
+	return scanHotWallets(rows)
+}
+
+func scanHotWallets(rows *sql.Rows) ([]*models.HotWallet, error) {
+	defer rows.Close()
+
+	var wallets []*models.HotWallet
+	for rows.Next() {
+		wallet, err := scanHotWallet(rows)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, wallet)
+	}
+	return wallets, rows.Err()
+}
+
+func (s *PostgresStorage) UpdateHotWalletBalance(id int64, balance string) error {
+	query := `
+		UPDATE hot_wallets
+		SET balance = $1, last_checked_at = $2
+		WHERE id = $3
+	`
+	_, err := s.db.Exec(query, balance, time.Now(), id)
+	return err
+}
+
+func (s *PostgresStorage) CreateHotWallet(wallet *models.HotWallet) error {
+	return createHotWallet(s.db, wallet)
+}
+
+func createHotWallet(db queryRower, wallet *models.HotWallet) error {
+	query := `
+		INSERT INTO hot_wallets (chain, address, encrypted_key, balance, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, last_checked_at, created_at
+	`
+	return db.QueryRow(
+		query,
+		wallet.Chain,
+		wallet.Address,
+		wallet.EncryptedKey,
+		wallet.Balance,
+		wallet.Status,
+	).Scan(&wallet.ID, &wallet.LastCheckedAt, &wallet.CreatedAt)
+}
+
+// ListHotWallets returns all wallets (including retired) for chain, or for all chains if chain is empty
+func (s *PostgresStorage) ListHotWallets(chain models.Chain) ([]*models.HotWallet, error) {
+	query := `
+		SELECT ` + hotWalletColumns + `
+		FROM hot_wallets
+		WHERE $1 = '' OR chain::text = $1
+		ORDER BY chain, created_at
+	`
+	rows, err := s.db.Query(query, string(chain))
+	if err != nil {
+		return nil, err
+	}
+	return scanHotWallets(rows)
+}
+
+func (s *PostgresStorage) RetireHotWallet(id int64) error {
+	return retireHotWallet(s.db, id)
+}
+
+func retireHotWallet(db execer, id int64) error {
+	query := `
+		UPDATE hot_wallets
+		SET status = 'retired', retired_at = $1
+		WHERE id = $2 AND status = 'active'
+	`
+	res, err := db.Exec(query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("active hot wallet %d not found", id)
+	}
+	return nil
+}
+
+// RotateHotWallet retires old wallet and creates new one in single transaction
+func (s *PostgresStorage) RotateHotWallet(oldID int64, wallet *models.HotWallet) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := retireHotWallet(tx, oldID); err != nil {
+		return err
+	}
+	if err := createHotWallet(tx, wallet); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithHotWalletLock runs fn holding advisory lock of hot wallet, so instances build, sign and broadcast
+// transactions from one wallet one at a time and don't take the same pending nonce
+func (s *PostgresStorage) WithHotWalletLock(ctx context.Context, chain models.Chain, address string, fn func() error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key := "hot_wallet/" + string(chain) + "/" + strings.ToLower(address)
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext($1))`, key); err != nil {
+		return fmt.Errorf("failed to lock hot wallet: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, key); err != nil {
+			// Session lock is released only with connection, it must not go back to pool
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	return fn()
+}
+
+// WalletTransfer methods
+const walletTransferColumns = `id, chain, direction, from_address, to_address, amount, tx_hash, status, unsigned_bundle, raw_tx, created_at, sent_at, confirmed_at`
+
+func scanWalletTransfer(row rowScanner) (*models.WalletTransfer, error) {
+	t := &models.WalletTransfer{}
+	err := row.Scan(
+		&t.ID,
+		&t.Chain,
+		&t.Direction,
+		&t.FromAddress,
+		&t.ToAddress,
+		&t.Amount,
+		&t.TxHash,
+		&t.Status,
+		&t.UnsignedBundle,
+		&t.RawTx,
+		&t.CreatedAt,
+		&t.SentAt,
+		&t.ConfirmedAt,
+	)
+	return t, err
+}
+
+// ErrOpenTransferExists is returned when chain already has rebalancing transfer in flight
+var ErrOpenTransferExists = errors.New("chain has open wallet transfer")
+
+// CreateWalletTransfer inserts transfer unless chain has open one. Check and insert run under
+// chain advisory lock, so instances rebalancing at the same time can't both create transfer.
+func (s *PostgresStorage) CreateWalletTransfer(transfer *models.WalletTransfer) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "wallet_transfers/"+string(transfer.Chain)); err != nil {
+		return err
+	}
+
+	var open bool
+	query := `SELECT EXISTS (SELECT 1 FROM wallet_transfers WHERE chain = $1 AND status IN ('requested', 'exported', 'sent'))`
+	if err := tx.QueryRow(query, transfer.Chain).Scan(&open); err != nil {
+		return err
+	}
+	if open {
+		return ErrOpenTransferExists
+	}
+
+	query = `
+		INSERT INTO wallet_transfers (chain, direction, from_address, to_address, amount, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRow(
+		query,
+		transfer.Chain,
+		transfer.Direction,
+		transfer.FromAddress,
+		transfer.ToAddress,
+		transfer.Amount,
+		transfer.Status,
+	).Scan(&transfer.ID, &transfer.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) GetWalletTransfer(id int64) (*models.WalletTransfer, error) {
+	query := `
+		SELECT ` + walletTransferColumns + `
+		FROM wallet_transfers
+		WHERE id = $1
+	`
+	transfer, err := scanWalletTransfer(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return transfer, err
+}
+
+// GetOpenWalletTransfers returns requested, exported and sent transfers for chain
+func (s *PostgresStorage) GetOpenWalletTransfers(chain models.Chain) ([]*models.WalletTransfer, error) {
+	query := `
+		SELECT ` + walletTransferColumns + `
+		FROM wallet_transfers
+		WHERE chain = $1 AND status IN ('requested', 'exported', 'sent')
+		ORDER BY created_at ASC
+	`
+	rows, err := s.db.Query(query, chain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*models.WalletTransfer
+	for rows.Next() {
+		t, err := scanWalletTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+func (s *PostgresStorage) UpdateWalletTransfer(transfer *models.WalletTransfer) error {
+	query := `
+		UPDATE wallet_transfers
+		SET tx_hash = $1, status = $2, unsigned_bundle = $3, sent_at = $4, confirmed_at = $5, raw_tx = $6, amount = $7
+		WHERE id = $8
+	`
+	_, err := s.db.Exec(
+		query,
+		transfer.TxHash,
+		transfer.Status,
+		transfer.UnsignedBundle,
+		transfer.SentAt,
+		transfer.ConfirmedAt,
+		transfer.RawTx,
+		transfer.Amount,
+		transfer.ID,
+	)
+	return err
+}
+
+// ErrTransferStateChanged is returned when wallet transfer left expected status or bundle was re-exported
+var ErrTransferStateChanged = errors.New("wallet transfer state changed")
+
+// SaveTransferBundle stores exported bundle of requested or already exported transfer
+func (s *PostgresStorage) SaveTransferBundle(id int64, bundle string) error {
+	query := `
+		UPDATE wallet_transfers
+		SET unsigned_bundle = $2, status = 'exported'
+		WHERE id = $1 AND status IN ('requested', 'exported')
+	`
+	result, err := s.db.Exec(query, id, bundle)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrTransferStateChanged
+	}
+	return nil
+}
+
+// MarkTransferSent moves exported transfer to sent with its signed tx. Bundle must still be
+// the one that was signed, so the same signed bundle can't be imported twice.
+func (s *PostgresStorage) MarkTransferSent(transfer *models.WalletTransfer, bundle string) error {
+	query := `
+		UPDATE wallet_transfers
+		SET status = 'sent', tx_hash = $3, raw_tx = $4, sent_at = NOW()
+		WHERE id = $1 AND status = 'exported' AND unsigned_bundle = $2
+		RETURNING ` + walletTransferColumns
+	updated, err := scanWalletTransfer(s.db.QueryRow(query, transfer.ID, bundle, transfer.TxHash, transfer.RawTx))
+	if err == sql.ErrNoRows {
+		return ErrTransferStateChanged
+	}
+	if err != nil {
+		return err
+	}
+	*transfer = *updated
+	return nil
+}
+
+// Monitor progress methods
+
+// GetMonitorProgress returns last block processed by deposit monitor, 0 if chain was never monitored
+func (s *PostgresStorage) GetMonitorProgress(chain models.Chain) (int64, error) {
+	var lastBlock int64
+	err := s.db.QueryRow(`SELECT last_block FROM monitor_progress WHERE chain = $1`, chain).Scan(&lastBlock)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return lastBlock, err
+}
+
+// SaveMonitorProgress saves last processed block, progress never moves back
+func (s *PostgresStorage) SaveMonitorProgress(chain models.Chain, lastBlock int64) error {
+	query := `
+		INSERT INTO monitor_progress (chain, last_block)
+		VALUES ($1, $2)
+		ON CONFLICT (chain) DO UPDATE SET last_block = GREATEST(monitor_progress.last_block, EXCLUDED.last_block), updated_at = NOW()
+	`
+	_, err := s.db.Exec(query, chain, lastBlock)
+	return err
+}
+
+// RescanJob methods
+const rescanJobColumns = `id, chain, from_block, to_block, next_block, status, error, failed_blocks,
+		       created_at, updated_at, started_at, finished_at`
+
+func scanRescanJob(row rowScanner) (*models.RescanJob, error) {
+	job := &models.RescanJob{}
+	err := row.Scan(
+		&job.ID,
+		&job.Chain,
+		&job.FromBlock,
+		&job.ToBlock,
+		&job.NextBlock,
+		&job.Status,
+		&job.Error,
+		pq.Array(&job.FailedBlocks),
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.StartedAt,
+		&job.FinishedAt,
+	)
+	return job, err
+}
+
+func (s *PostgresStorage) CreateRescanJob(job *models.RescanJob) error {
+	query := `
+		INSERT INTO rescan_jobs (chain, from_block, to_block, next_block, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+	return s.db.QueryRow(
+		query,
+		job.Chain,
+		job.FromBlock,
+		job.ToBlock,
+		job.NextBlock,
+		job.Status,
+	).Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+}
+
+func (s *PostgresStorage) GetRescanJob(id int64) (*models.RescanJob, error) {
+	query := `
+		SELECT ` + rescanJobColumns + `
+		FROM rescan_jobs
+		WHERE id = $1
+	`
+	job, err := scanRescanJob(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ListRescanJobs returns latest jobs first
+func (s *PostgresStorage) ListRescanJobs(limit int) ([]*models.RescanJob, error) {
+	query := `
+		SELECT ` + rescanJobColumns + `
+		FROM rescan_jobs
+		ORDER BY id DESC
+		LIMIT $1
+	`
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.RescanJob
+	for rows.Next() {
+		job, err := scanRescanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimRescanJob marks oldest queued job for given chains as running and returns it.
+// Running job without heartbeat for staleAfter is taken over (its worker died).
+// Returns nil if there is nothing to do.
+func (s *PostgresStorage) ClaimRescanJob(chains []models.Chain, staleAfter time.Duration) (*models.RescanJob, error) {
+	names := make([]string, len(chains))
+	for i, chain := range chains {
+		names[i] = string(chain)
+	}
+
+	query := `
+		UPDATE rescan_jobs
+		SET status = 'running', started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM rescan_jobs
+			WHERE chain::text = ANY($1)
+			  AND (status = 'queued' OR (status = 'running' AND updated_at < NOW() - $2 * INTERVAL '1 second'))
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + rescanJobColumns
+	job, err := scanRescanJob(s.db.QueryRow(query, pq.Array(names), int64(staleAfter.Seconds())))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// UpdateRescanJob saves progress and status, also refreshes heartbeat
+func (s *PostgresStorage) UpdateRescanJob(job *models.RescanJob) error {
+	query := `
+		UPDATE rescan_jobs
+		SET next_block = $1, status = $2, error = $3, finished_at = $4, failed_blocks = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING updated_at
+	`
+	return s.db.QueryRow(query, job.NextBlock, job.Status, job.Error, job.FinishedAt, pq.Array(job.FailedBlocks), job.ID).Scan(&job.UpdatedAt)
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dechat/exchange-service/internal/models"
+)
+
+// ErrLimitExceeded is returned when withdrawal doesn't fit into one of withdrawal limits
+var ErrLimitExceeded = errors.New("withdrawal limit exceeded")
+
+// Withdrawals that will never leave don't use limits
+const limitedWithdrawalStatuses = `status::text NOT IN ('failed', 'rejected', 'cancelled')`
+
+const withdrawalLimitColumns = `id, chain, asset, user_id, window_seconds, max_amount, created_at`
+
+func scanWithdrawalLimit(row rowScanner) (*models.WithdrawalLimit, error) {
+	limit := &models.WithdrawalLimit{}
+	err := row.Scan(
+		&limit.ID,
+		&limit.Chain,
+		&limit.Asset,
+		&limit.UserID,
+		&limit.WindowSeconds,
+		&limit.MaxAmount,
+		&limit.CreatedAt,
+	)
+	return limit, err
+}
+
+// CheckWithdrawalLimits checks that withdrawal fits into its limits together with other withdrawals in window.
+// Withdrawal itself is not counted as usage, it's checked again before sending.
+func (s *PostgresStorage) CheckWithdrawalLimits(withdrawal *models.Withdrawal) error {
+	return checkWithdrawalLimits(s.db, withdrawal)
+}
+
+func checkWithdrawalLimits(db querier, withdrawal *models.Withdrawal) error {
+	amount, ok := new(big.Int).SetString(withdrawal.Amount, 10)
+	if !ok {
+		return fmt.Errorf("invalid amount: %s", withdrawal.Amount)
+	}
+
+	query := `
+		SELECT ` + withdrawalLimitColumns + `
+		FROM withdrawal_limits
+		WHERE chain = $1 AND asset = $2 AND user_id IN ('', '*', $3)
+		ORDER BY id
+	`
+	rows, err := db.Query(query, withdrawal.Chain, withdrawal.Asset, withdrawal.UserID)
+	if err != nil {
+		return err
+	}
+	var limits []*models.WithdrawalLimit
+	for rows.Next() {
+		limit, err := scanWithdrawalLimit(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		limits = append(limits, limit)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, limit := range limits {
+		maxAmount, ok := new(big.Int).SetString(limit.MaxAmount, 10)
+		if !ok {
+			return fmt.Errorf("invalid max amount of withdrawal limit %d: %s", limit.ID, limit.MaxAmount)
+		}
+		usage, err := withdrawalLimitUsage(db, limit, withdrawal.UserID, withdrawal.ID)
+		if err != nil {
+			return err
+		}
+		if new(big.Int).Add(usage, amount).Cmp(maxAmount) > 0 {
+			return fmt.Errorf("%w: %s %s%s per %s, used %s of %s, requested %s",
+				ErrLimitExceeded, limit.Chain, limit.Asset, limitScope(limit), time.Duration(limit.WindowSeconds)*time.Second,
+				usage, maxAmount, amount)
+		}
+	}
+	return nil
+}
+
+// withdrawalLimitUsage sums withdrawals counted towards limit, userID is used for per user ("*") limit.
+// Window is over send time: withdrawals not sent yet (pending, awaiting approval, processing) are
+// always counted, so ones queued long ago can't all leave at once.
+func withdrawalLimitUsage(db queryRower, limit *models.WithdrawalLimit, userID string, excludeID int64) (*big.Int, error) {
+	perUser := limit.UserID != ""
+	if limit.UserID != "*" {
+		userID = limit.UserID
+	}
+
+	query := `
+		SELECT COALESCE(SUM(amount::numeric), 0)::text
+		FROM withdrawals
+		WHERE chain = $1 AND asset = $2
+		  AND COALESCE(sent_at, NOW()) > NOW() - $3 * INTERVAL '1 second'
+		  AND ` + limitedWithdrawalStatuses + `
+		  AND (NOT $4 OR user_id = $5)
+		  AND id <> $6
+	`
+	var sum string
+	if err := db.QueryRow(query, limit.Chain, limit.Asset, limit.WindowSeconds, perUser, userID, excludeID).Scan(&sum); err != nil {
+		return nil, err
+	}
+	usage, ok := new(big.Int).SetString(sum, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid withdrawal usage: %s", sum)
+	}
+	return usage, nil
+}
+
+func limitScope(limit *models.WithdrawalLimit) string {
+	switch limit.UserID {
+	case "":
+		return ""
+	case "*":
+		return " per user"
+	}
+	return " for user " + limit.UserID
+}
+
+func (s *PostgresStorage) CreateWithdrawalLimit(limit *models.WithdrawalLimit) error {
+	query := `
+		INSERT INTO withdrawal_limits (chain, asset, user_id, window_seconds, max_amount)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (chain, asset, user_id, window_seconds) DO UPDATE SET max_amount = EXCLUDED.max_amount
+		RETURNING id, created_at
+	`
+	return s.db.QueryRow(query, limit.Chain, limit.Asset, limit.UserID, limit.WindowSeconds, limit.MaxAmount).Scan(&limit.ID, &limit.CreatedAt)
+}
+
+// ListWithdrawalLimits returns all limits with current usage. Usage of per user ("*") limits
+// is shown for userID, or left empty without it.
+func (s *PostgresStorage) ListWithdrawalLimits(userID string) ([]*models.WithdrawalLimit, error) {
+	query := `
+		SELECT ` + withdrawalLimitColumns + `
+		FROM withdrawal_limits
+		ORDER BY chain, asset, user_id, window_seconds
+	`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var limits []*models.WithdrawalLimit
+	for rows.Next() {
+		limit, err := scanWithdrawalLimit(rows)
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, limit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, limit := range limits {
+		if limit.UserID == "*" && userID == "" {
+			continue
+		}
+		usage, err := withdrawalLimitUsage(s.db, limit, userID, 0)
+		if err != nil {
+			return nil, err
+		}
+		limit.Usage = usage.String()
+	}
+	return limits, nil
+}
+
+// DeleteWithdrawalLimit removes limit, returns false if it doesn't exist
+func (s *PostgresStorage) DeleteWithdrawalLimit(id int64) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM withdrawal_limits WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
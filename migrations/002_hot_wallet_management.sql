@@ -0,0 +1,9 @@
+-- Hot wallet lifecycle: wallets are retired instead of deleted
+ALTER TABLE hot_wallets ADD COLUMN status VARCHAR(50) NOT NULL DEFAULT 'active';
+ALTER TABLE hot_wallets ADD COLUMN created_at TIMESTAMP DEFAULT NOW();
+ALTER TABLE hot_wallets ADD COLUMN retired_at TIMESTAMP;
+
+-- Only one active wallet per chain, retired ones are kept for history
+ALTER TABLE hot_wallets DROP CONSTRAINT hot_wallets_chain_key;
+CREATE UNIQUE INDEX idx_hot_wallets_active_chain ON hot_wallets(chain) WHERE status = 'active';
+CREATE UNIQUE INDEX idx_hot_wallets_chain_address ON hot_wallets(chain, address);
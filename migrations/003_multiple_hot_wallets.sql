@@ -0,0 +1,3 @@
+-- Several active hot wallets per chain, withdrawals pick one at send time
+DROP INDEX idx_hot_wallets_active_chain;
+CREATE INDEX idx_hot_wallets_chain_status ON hot_wallets(chain, status);
@@ -0,0 +1,20 @@
+-- Hot <-> cold wallet transfers created by rebalancing
+CREATE TYPE wallet_transfer_direction_type AS ENUM ('hot_to_cold', 'cold_to_hot');
+CREATE TYPE wallet_transfer_status_type AS ENUM ('requested', 'sent', 'confirmed', 'failed');
+
+CREATE TABLE wallet_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    chain chain_type NOT NULL,
+    direction wallet_transfer_direction_type NOT NULL,
+    from_address VARCHAR(255) NOT NULL,
+    to_address VARCHAR(255) NOT NULL,
+    amount VARCHAR(255) NOT NULL,
+    tx_hash VARCHAR(255) NOT NULL DEFAULT '',
+    raw_tx TEXT NOT NULL DEFAULT '', -- signed sweep tx, saved before broadcast so it can be rebroadcast or reconciled
+    status wallet_transfer_status_type NOT NULL DEFAULT 'requested',
+    created_at TIMESTAMP DEFAULT NOW(),
+    sent_at TIMESTAMP,
+    confirmed_at TIMESTAMP
+);
+
+CREATE INDEX idx_wallet_transfers_chain_status ON wallet_transfers(chain, status);
@@ -0,0 +1,5 @@
+-- Last exported unsigned bundle (JSON) for cold wallet transfers
+ALTER TABLE wallet_transfers ADD COLUMN unsigned_bundle TEXT NOT NULL DEFAULT '';
+
+-- Cold wallet transfer whose bundle was exported for offline signing
+ALTER TYPE wallet_transfer_status_type ADD VALUE 'exported';
@@ -0,0 +1,14 @@
+-- Payment outcome once deposit is confirmed
+ALTER TYPE deposit_status_type ADD VALUE 'underpaid';
+ALTER TYPE deposit_status_type ADD VALUE 'paid';
+ALTER TYPE deposit_status_type ADD VALUE 'overpaid';
+
+-- 'native' or token contract address
+ALTER TABLE deposits ADD COLUMN asset VARCHAR(255) NOT NULL DEFAULT 'native';
+
+-- How under/overpayment was resolved by order system: top_up, refund, accept
+ALTER TABLE deposits ADD COLUMN resolution VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE deposits ADD COLUMN refund_address VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE deposits ADD COLUMN refund_amount VARCHAR(255) NOT NULL DEFAULT '0';
+ALTER TABLE deposits ADD COLUMN refund_withdrawal_id BIGINT REFERENCES withdrawals(id);
+ALTER TABLE deposits ADD COLUMN resolved_at TIMESTAMP;
@@ -0,0 +1,22 @@
+-- Every incoming transfer to deposit address, deposit totals are derived from them
+CREATE TABLE deposit_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    deposit_id BIGINT NOT NULL REFERENCES deposits(id),
+    chain chain_type NOT NULL,
+    tx_hash VARCHAR(255) NOT NULL,
+    log_index INTEGER NOT NULL, -- -1 for native transfers
+    from_address VARCHAR(255) NOT NULL DEFAULT '',
+    asset VARCHAR(255) NOT NULL,
+    amount VARCHAR(255) NOT NULL,
+    block_number BIGINT NOT NULL,
+    confirmations INTEGER NOT NULL DEFAULT 0,
+    confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+    wrong_asset BOOLEAN NOT NULL DEFAULT FALSE, -- other asset than deposit expects, not counted, ops refund it
+    created_at TIMESTAMP DEFAULT NOW(),
+    confirmed_at TIMESTAMP,
+    UNIQUE (chain, tx_hash, log_index)
+);
+
+CREATE INDEX idx_deposit_transfers_deposit_id ON deposit_transfers(deposit_id);
+CREATE INDEX idx_deposit_transfers_unconfirmed ON deposit_transfers(chain) WHERE NOT confirmed;
+CREATE INDEX idx_deposit_transfers_wrong_asset ON deposit_transfers(chain) WHERE wrong_asset;
@@ -0,0 +1,10 @@
+-- Funds arrived after deposit expired, ops decide whether to refund or honor them
+ALTER TYPE deposit_status_type ADD VALUE 'late';
+
+-- Unpaid deposits expire at expires_at, address is watched until watch_until (expiry + grace period)
+ALTER TABLE deposits ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE deposits ADD COLUMN watch_until TIMESTAMP;
+
+CREATE INDEX idx_deposits_expires_at ON deposits(expires_at) WHERE status = 'pending';
+
+ALTER TABLE deposit_transfers ADD COLUMN late BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+-- order: fresh address per order, static: one permanent address per user and chain.
+-- Every transfer to static address is standalone user credit.
+ALTER TABLE deposits ADD COLUMN mode VARCHAR(50) NOT NULL DEFAULT 'order';
+
+CREATE UNIQUE INDEX idx_deposits_static_user ON deposits(chain, user_id) WHERE mode = 'static';
@@ -0,0 +1,13 @@
+-- Notify service instances about new deposit addresses so their in-memory address index stays in sync
+CREATE OR REPLACE FUNCTION notify_deposit_address() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('deposit_addresses', NEW.chain::text || ':' || NEW.address);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER deposits_notify_address
+    AFTER INSERT ON deposits
+    FOR EACH ROW EXECUTE FUNCTION notify_deposit_address();
+
+CREATE INDEX idx_deposits_chain_watch_until ON deposits(chain, watch_until);
@@ -0,0 +1,24 @@
+-- Block range rescans requested by admin, processed by rescan worker
+CREATE TABLE rescan_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    chain chain_type NOT NULL,
+    from_block BIGINT NOT NULL,
+    to_block BIGINT NOT NULL,
+    next_block BIGINT NOT NULL, -- progress, first block not processed yet
+    status VARCHAR(50) NOT NULL DEFAULT 'queued', -- queued, running, completed, failed
+    error TEXT NOT NULL DEFAULT '',
+    failed_blocks BIGINT[] NOT NULL DEFAULT '{}', -- blocks that couldn't be processed, job goes on
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(), -- heartbeat of running job
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX idx_rescan_jobs_status ON rescan_jobs(status);
+
+-- Last block processed by live deposit monitor, it resumes after it on restart
+CREATE TABLE monitor_progress (
+    chain chain_type PRIMARY KEY,
+    last_block BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+-- Payment seen in mempool or in block but not confirmed yet, nothing is credited
+ALTER TYPE deposit_status_type ADD VALUE 'detected';
+
+ALTER TABLE deposits ADD COLUMN detected_tx_hash VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE deposits ADD COLUMN detected_at TIMESTAMP;
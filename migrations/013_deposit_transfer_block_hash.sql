@@ -0,0 +1,2 @@
+-- Block transfer was seen in, transfer is confirmed only while this block is canonical
+ALTER TABLE deposit_transfers ADD COLUMN block_hash VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Pre-generated deposit addresses, row is deleted when address is assigned to deposit
+CREATE TABLE deposit_address_pool (
+    id BIGSERIAL PRIMARY KEY,
+    chain chain_type NOT NULL,
+    address VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_deposit_address_pool_chain ON deposit_address_pool(chain, id);
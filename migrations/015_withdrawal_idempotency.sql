@@ -0,0 +1,5 @@
+-- Idempotency-Key header (or order_id when header is missing), repeated request returns original withdrawal.
+-- NULL for withdrawals created before keys were introduced.
+ALTER TABLE withdrawals ADD COLUMN idempotency_key VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_withdrawals_idempotency_key ON withdrawals(idempotency_key);
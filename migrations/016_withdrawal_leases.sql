@@ -0,0 +1,9 @@
+-- Withdrawal is claimed by one instance for lease duration, expired lease is recovered by another one
+ALTER TYPE withdrawal_status_type ADD VALUE 'processing';
+
+ALTER TABLE withdrawals ADD COLUMN lease_owner VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE withdrawals ADD COLUMN lease_expires_at TIMESTAMP;
+-- Signed tx is saved before broadcasting, so recovery can rebroadcast it instead of signing new one
+ALTER TABLE withdrawals ADD COLUMN raw_tx TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_withdrawals_chain_status ON withdrawals(chain, status);
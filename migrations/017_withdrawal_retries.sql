@@ -0,0 +1,16 @@
+-- Transient errors are retried with backoff, permanent ones fail withdrawal with reason
+ALTER TABLE withdrawals ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE withdrawals ADD COLUMN next_attempt_at TIMESTAMPTZ; -- written from service clock, compared to NOW()
+ALTER TABLE withdrawals ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE withdrawals ADD COLUMN failure_reason TEXT NOT NULL DEFAULT '';
+
+-- Withdrawal history: retries, failures, sending and confirmation
+CREATE TABLE withdrawal_events (
+    id BIGSERIAL PRIMARY KEY,
+    withdrawal_id BIGINT NOT NULL REFERENCES withdrawals(id),
+    type VARCHAR(50) NOT NULL, -- retry, failed, sent, confirmed
+    message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_withdrawal_events_withdrawal_id ON withdrawal_events(withdrawal_id);
@@ -0,0 +1,18 @@
+-- Withdrawals matching approval policy wait for distinct approvers before they are processed
+ALTER TYPE withdrawal_status_type ADD VALUE 'awaiting_approval';
+ALTER TYPE withdrawal_status_type ADD VALUE 'rejected';
+
+ALTER TABLE withdrawals ADD COLUMN user_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE withdrawals ADD COLUMN required_approvals INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE withdrawals ADD COLUMN approval_reason TEXT NOT NULL DEFAULT ''; -- policy rule that matched
+
+-- Audit trail of approver decisions, one per approver
+CREATE TABLE withdrawal_approvals (
+    id BIGSERIAL PRIMARY KEY,
+    withdrawal_id BIGINT NOT NULL REFERENCES withdrawals(id),
+    approver VARCHAR(255) NOT NULL,
+    decision VARCHAR(50) NOT NULL, -- approved, rejected
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (withdrawal_id, approver)
+);
@@ -0,0 +1,17 @@
+-- Withdrawals only send native coin for now, asset is kept for per-asset limits
+ALTER TABLE withdrawals ADD COLUMN asset VARCHAR(255) NOT NULL DEFAULT 'native';
+
+CREATE INDEX idx_withdrawals_chain_created_at ON withdrawals(chain, created_at);
+
+-- Rolling window limits of chain asset, there is no limit across chains or assets.
+-- Usage is sum of withdrawals sent within window or not sent yet, except failed, rejected or cancelled
+CREATE TABLE withdrawal_limits (
+    id BIGSERIAL PRIMARY KEY,
+    chain chain_type NOT NULL,
+    asset VARCHAR(255) NOT NULL DEFAULT 'native',
+    user_id VARCHAR(255) NOT NULL DEFAULT '', -- '' all withdrawals of chain asset together, '*' every user separately, otherwise one user
+    window_seconds INTEGER NOT NULL,
+    max_amount VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (chain, asset, user_id, window_seconds)
+);
@@ -0,0 +1,23 @@
+-- User managed withdrawal destinations, new address can be used after cooldown
+CREATE TABLE withdrawal_addresses (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    chain chain_type NOT NULL,
+    address VARCHAR(255) NOT NULL,
+    label VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW(),
+    usable_after TIMESTAMPTZ NOT NULL -- written from service clock, compared to current time
+);
+
+CREATE UNIQUE INDEX idx_withdrawal_addresses_user_address ON withdrawal_addresses(user_id, chain, lower(address));
+
+-- Whitelist-only users can withdraw only to their address book
+CREATE TABLE withdrawal_user_settings (
+    user_id VARCHAR(255) PRIMARY KEY,
+    whitelist_only BOOLEAN NOT NULL DEFAULT FALSE,
+    whitelist_only_until TIMESTAMPTZ, -- turning whitelist-only off takes effect after cooldown, enforced until then
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Address book label at creation time, for reports
+ALTER TABLE withdrawals ADD COLUMN to_label VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Destination has code, gas limit is estimated instead of 21000
+ALTER TABLE withdrawals ADD COLUMN to_contract BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,20 @@
+-- Merchant chooses whether withdrawal fees are charged on top of amount or deducted from it
+CREATE TABLE merchant_fee_settings (
+    merchant_id VARCHAR(255) PRIMARY KEY,
+    fee_mode VARCHAR(20) NOT NULL DEFAULT 'on_top',
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Fees quoted at creation, fee column gets actual network fee once mined
+ALTER TABLE withdrawals ADD COLUMN merchant_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE withdrawals ADD COLUMN fee_mode VARCHAR(20) NOT NULL DEFAULT 'on_top';
+ALTER TABLE withdrawals ADD COLUMN quoted_fee VARCHAR(255) NOT NULL DEFAULT '0';
+ALTER TABLE withdrawals ADD COLUMN service_fee VARCHAR(255) NOT NULL DEFAULT '0';
+ALTER TABLE withdrawals ADD COLUMN receive_amount VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Existing withdrawals paid fees on top
+UPDATE withdrawals SET receive_amount = amount;
+
+-- Idempotency keys are chosen by merchants, so they are unique per merchant
+DROP INDEX idx_withdrawals_idempotency_key;
+CREATE UNIQUE INDEX idx_withdrawals_merchant_idempotency_key ON withdrawals(merchant_id, idempotency_key);
@@ -0,0 +1,2 @@
+-- Withdrawal cancelled before it was claimed for sending
+ALTER TYPE withdrawal_status_type ADD VALUE 'cancelled';
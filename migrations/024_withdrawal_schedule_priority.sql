@@ -0,0 +1,3 @@
+-- Scheduled withdrawal isn't claimed before not_before, priority orders the queue and sets gas price
+ALTER TABLE withdrawals ADD COLUMN not_before TIMESTAMPTZ; -- client sends any offset
+ALTER TABLE withdrawals ADD COLUMN priority VARCHAR(10) NOT NULL DEFAULT 'normal';